@@ -0,0 +1,256 @@
+package otelkit
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+)
+
+// AssertBaggage fails the test if the baggage in the context has no member with the given key,
+// or if the member's value differs from the expected one.
+func AssertBaggage(tb testingTB, ctx context.Context, key, want string) {
+	tb.Helper()
+	member := baggage.FromContext(ctx).Member(key)
+	if member.Key() == "" {
+		tb.Fatalf("expected baggage member %q to be present, but it was missing", key)
+		return
+	}
+	if got := member.Value(); got != want {
+		tb.Fatalf("expected baggage member %q to have value %q, but got %q", key, want, got)
+	}
+}
+
+// AssertBaggagePropagated fails the test if the baggage extracted from the request headers with the propagator
+// has no member with the given key, or if the member's value differs from the expected one.
+// When the propagator is nil, DefaultPropagator is used.
+func AssertBaggagePropagated(tb testingTB, propagator propagation.TextMapPropagator, r *http.Request, key, want string) {
+	tb.Helper()
+	if propagator == nil {
+		propagator = DefaultPropagator()
+	}
+	AssertBaggage(tb, propagator.Extract(context.Background(), propagation.HeaderCarrier(r.Header)), key, want)
+}
+
+// AssertDistinctTraces fails the test if any two captured spans with the given name share the same trace id.
+// It's meant to catch span context leaking from one request into another.
+func AssertDistinctTraces(tb testingTB, exporter SpanCapturer, name string) {
+	tb.Helper()
+	var found bool
+	traceIDs := map[trace.TraceID]trace.SpanID{}
+	for _, span := range exporter.ExportedSpans() {
+		if span.Name() != name {
+			continue
+		}
+		found = true
+		sc := span.SpanContext()
+		if other, ok := traceIDs[sc.TraceID()]; ok {
+			tb.Fatalf("expected %q spans to have distinct traces, but span %s and %s share trace %s",
+				name, other, sc.SpanID(), sc.TraceID())
+			return
+		}
+		traceIDs[sc.TraceID()] = sc.SpanID()
+	}
+	if !found {
+		tb.Fatalf("expected to find spans with the name of %q, but none was captured", name)
+	}
+}
+
+// AssertSpanEnded fails the test if no span with the given name reached the exporter.
+// Spans are only exported once they are ended,
+// so a missing span is usually the sign of a span that was started but never ended.
+func AssertSpanEnded(tb testingTB, exporter SpanCapturer, name string) {
+	tb.Helper()
+	if _, names, ok := findExportedSpan(exporter, name); !ok {
+		tb.Fatalf("expected span %q to be ended and exported, but it wasn't; exported spans: %q", name, names)
+	}
+}
+
+// AssertSpanExists fails the test if no exported span has the given name, and returns the first one that has it.
+// The failure message lists the names of the exported spans.
+func AssertSpanExists(tb testingTB, exporter SpanCapturer, name string) traceSDK.ReadOnlySpan {
+	tb.Helper()
+	span, names, ok := findExportedSpan(exporter, name)
+	if !ok {
+		tb.Fatalf("expected span %q to be exported, but it wasn't; exported spans: %q", name, names)
+	}
+	return span
+}
+
+// findExportedSpan returns the first exported span with the given name,
+// or the names of the exported spans when there is none.
+func findExportedSpan(exporter SpanCapturer, name string) (traceSDK.ReadOnlySpan, []string, bool) {
+	var names []string
+	for _, span := range exporter.ExportedSpans() {
+		if span.Name() == name {
+			return span, nil, true
+		}
+		names = append(names, span.Name())
+	}
+	return nil, names, false
+}
+
+// AssertSpanHasAttribute fails the test if the span has no attribute with the given key,
+// or if the attribute's value differs from the expected one.
+// The failure message lists the attribute keys of the span.
+func AssertSpanHasAttribute(tb testingTB, span traceSDK.ReadOnlySpan, key attribute.Key, want attribute.Value) {
+	tb.Helper()
+	var keys []string
+	for _, kv := range span.Attributes() {
+		if kv.Key != key {
+			keys = append(keys, string(kv.Key))
+			continue
+		}
+		if kv.Value != want {
+			tb.Fatalf("expected span %q to have the %q attribute with the value of %s, but got %s",
+				span.Name(), key, want.Emit(), kv.Value.Emit())
+		}
+		return
+	}
+	tb.Fatalf("expected span %q to have the %q attribute, but it's missing; span attributes: %q", span.Name(), key, keys)
+}
+
+// AssertRecordedError fails the test if the span has no exception event
+// with an exception.message that contains wantSubstr.
+// Such event is created by trace.Span.RecordError.
+func AssertRecordedError(tb testingTB, span traceSDK.ReadOnlySpan, wantSubstr string) {
+	tb.Helper()
+	var messages []string
+	for _, event := range span.Events() {
+		if event.Name != semconv.ExceptionEventName {
+			continue
+		}
+		for _, kv := range event.Attributes {
+			if kv.Key != semconv.ExceptionMessageKey {
+				continue
+			}
+			if strings.Contains(kv.Value.AsString(), wantSubstr) {
+				return
+			}
+			messages = append(messages, kv.Value.AsString())
+		}
+	}
+	if len(messages) == 0 {
+		tb.Fatalf("expected span %q to have a recorded error containing %q, but it has no exception event",
+			span.Name(), wantSubstr)
+		return
+	}
+	tb.Fatalf("expected span %q to have a recorded error containing %q, but got: %q",
+		span.Name(), wantSubstr, messages)
+}
+
+// AssertChildOfContext fails the test if the span's parent is not the span context found in ctx.
+// It's meant to verify that an outbound span continues the trace of the context it was made from.
+func AssertChildOfContext(tb testingTB, ctx context.Context, span traceSDK.ReadOnlySpan) {
+	tb.Helper()
+	want := trace.SpanContextFromContext(ctx)
+	if !want.IsValid() {
+		tb.Fatalf("expected the context to have a valid span context, but it has none")
+		return
+	}
+	got := span.Parent()
+	if got.TraceID() != want.TraceID() || got.SpanID() != want.SpanID() {
+		tb.Fatalf("expected span %q to be the child of span %s in trace %s, but its parent is span %s in trace %s",
+			span.Name(), want.SpanID(), want.TraceID(), got.SpanID(), got.TraceID())
+	}
+}
+
+// AssertChildOf fails the test if the child span is not the direct child of the parent span,
+// e.g. when an outbound span doesn't continue the trace of the inbound span.
+func AssertChildOf(tb testingTB, child, parent traceSDK.ReadOnlySpan) {
+	tb.Helper()
+	want := parent.SpanContext()
+	got := child.Parent()
+	if got.TraceID() != want.TraceID() {
+		tb.Fatalf("expected span %q to be the child of span %q, but they belong to different traces: %s and %s",
+			child.Name(), parent.Name(), child.SpanContext().TraceID(), want.TraceID())
+		return
+	}
+	if got.SpanID() != want.SpanID() {
+		tb.Fatalf("expected span %q to be the child of span %q (%s), but its parent is span %s",
+			child.Name(), parent.Name(), want.SpanID(), got.SpanID())
+	}
+}
+
+// AssertNextReceivesTracedContext serves the request with the middleware made by mw,
+// and fails the test if the next handler is not called with a request context that has a valid span context.
+func AssertNextReceivesTracedContext(tb testingTB, mw func(next http.Handler) http.Handler, r *http.Request) {
+	tb.Helper()
+	var (
+		called bool
+		sc     trace.SpanContext
+	)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		sc = trace.SpanContextFromContext(r.Context())
+	})
+	mw(next).ServeHTTP(httptest.NewRecorder(), r)
+	if !called {
+		tb.Fatalf("expected the next handler to be called, but it wasn't")
+		return
+	}
+	if !sc.IsValid() {
+		tb.Fatalf("expected the next handler to receive a context with a valid span context, but got: %#v", sc)
+	}
+}
+
+// AssertSpanLacksAttribute fails the test if the span carries an attribute with the forbidden key,
+// e.g. http.request.header.authorization.
+// It's meant to enforce that secrets and personal data never make it into the spans.
+func AssertSpanLacksAttribute(tb testingTB, span traceSDK.ReadOnlySpan, key attribute.Key) {
+	tb.Helper()
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			tb.Fatalf("expected span %q to not have the %q attribute, but it has it", span.Name(), key)
+			return
+		}
+	}
+}
+
+// AssertSpanKind fails the test if the span's kind differs from the wanted one.
+func AssertSpanKind(tb testingTB, span traceSDK.ReadOnlySpan, want trace.SpanKind) {
+	tb.Helper()
+	if got := span.SpanKind(); got != want {
+		tb.Fatalf("expected span %q to be of %s kind, but got %s", span.Name(), want, got)
+	}
+}
+
+// AssertMissingHeaders fails the test if the warning event's missing headers don't match exactly the wanted ones.
+// The order doesn't matter, and since the missing header keys are reported in lower case,
+// the wanted keys are compared case-insensitively.
+func AssertMissingHeaders(tb testingTB, event NoTracingWarningEvent, want ...string) {
+	tb.Helper()
+	got := sortedLowerCase(event.MissingHeaders)
+	exp := sortedLowerCase(want)
+	if !equalStrings(got, exp) {
+		tb.Fatalf("expected missing headers to be %q, but got %q", exp, got)
+	}
+}
+
+func sortedLowerCase(vs []string) []string {
+	out := make([]string, 0, len(vs))
+	for _, v := range vs {
+		out = append(out, strings.ToLower(v))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,465 @@
+package otelkit_test
+
+import (
+	"context"
+	"errors"
+	"github.com/adamluzsi/otelkit"
+	"github.com/adamluzsi/testcase"
+	"github.com/adamluzsi/testcase/assert"
+	"github.com/adamluzsi/testcase/sandbox"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func assertPasses(tb testing.TB, blk func(stub *testcase.StubTB)) {
+	tb.Helper()
+	stub := &testcase.StubTB{}
+	out := sandbox.Run(func() { blk(stub) })
+	assert.True(tb, out.OK, "expected the assertion to pass")
+	assert.False(tb, stub.IsFailed, stub.Logs.String())
+}
+
+func assertFails(tb testing.TB, blk func(stub *testcase.StubTB)) string {
+	tb.Helper()
+	stub := &testcase.StubTB{}
+	sandbox.Run(func() { blk(stub) })
+	assert.True(tb, stub.IsFailed, "expected the assertion to fail")
+	return stub.Logs.String()
+}
+
+func TestAssertBaggage(t *testing.T) {
+	member, err := baggage.NewMember("key", "value")
+	assert.NoError(t, err)
+	ctx, err := otelkit.ContextWithBaggage(context.Background(), member)
+	assert.NoError(t, err)
+
+	t.Run("matching member", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertBaggage(stub, ctx, "key", "value")
+		})
+	})
+
+	t.Run("different value", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertBaggage(stub, ctx, "key", "other")
+		})
+		assert.Contain(t, logs, `"other"`)
+	})
+
+	t.Run("missing member", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertBaggage(stub, ctx, "missing", "value")
+		})
+		assert.Contain(t, logs, `"missing"`)
+	})
+}
+
+func TestAssertBaggagePropagated(t *testing.T) {
+	member, err := baggage.NewMember("key", "value")
+	assert.NoError(t, err)
+	ctx, err := otelkit.ContextWithBaggage(context.Background(), member)
+	assert.NoError(t, err)
+
+	var received *http.Request
+	_, err = otelkit.HTTPRoundTripper{
+		Next: RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			received = r
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}),
+		Propagator: propagation.Baggage{},
+		Tracer:     NewTracerProvider(&otelkit.FakeSpanExporter{}).Tracer("tracer"),
+	}.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	assert.NoError(t, err)
+
+	t.Run("propagated member", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertBaggagePropagated(stub, propagation.Baggage{}, received, "key", "value")
+		})
+	})
+
+	t.Run("different value", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertBaggagePropagated(stub, propagation.Baggage{}, received, "key", "other")
+		})
+		assert.Contain(t, logs, `"other"`)
+	})
+
+	t.Run("request without baggage", func(t *testing.T) {
+		assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertBaggagePropagated(stub, propagation.Baggage{}, httptest.NewRequest(http.MethodGet, "/", nil), "key", "value")
+		})
+	})
+}
+
+func TestAssertDistinctTraces(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tracer := NewTracerProvider(exp).Tracer("tracer")
+
+	_, spanA := tracer.Start(context.Background(), "request")
+	spanA.End()
+	_, spanB := tracer.Start(context.Background(), "request")
+	spanB.End()
+
+	t.Run("spans belong to different traces", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertDistinctTraces(stub, exp, "request")
+		})
+	})
+
+	t.Run("span leaked into another request's trace", func(t *testing.T) {
+		ctx := trace.ContextWithSpanContext(context.Background(), spanA.SpanContext())
+		_, leaked := tracer.Start(ctx, "request")
+		leaked.End()
+		t.Cleanup(exp.Reset)
+
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertDistinctTraces(stub, exp, "request")
+		})
+		assert.Contain(t, logs, spanA.SpanContext().TraceID().String())
+	})
+
+	t.Run("no span with the name", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertDistinctTraces(stub, exp, "unknown")
+		})
+		assert.Contain(t, logs, `"unknown"`)
+	})
+}
+
+func TestAssertSpanEnded(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tracer := NewTracerProvider(exp).Tracer("tracer")
+
+	otelkit.HTTPMiddlewareTracing{
+		Next:       http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		Propagator: propagation.TraceContext{},
+		Tracer:     tracer,
+	}.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	_, leaked := tracer.Start(context.Background(), "leaked")
+	_ = leaked // never ended
+
+	t.Run("span of the served request is ended", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertSpanEnded(stub, exp, "http-server-request")
+		})
+	})
+
+	t.Run("span is never ended", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertSpanEnded(stub, exp, "leaked")
+		})
+		assert.Contain(t, logs, `"leaked"`)
+		assert.Contain(t, logs, "http-server-request")
+	})
+}
+
+func TestAssertSpanExists(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tp := NewTracerProvider(exp)
+	for _, name := range []string{"foo", "bar"} {
+		_, span := tp.Tracer("tracer").Start(context.Background(), name)
+		span.End()
+	}
+
+	t.Run("span exists", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			span := otelkit.AssertSpanExists(stub, exp, "bar")
+			assert.Equal(t, "bar", span.Name())
+		})
+	})
+
+	t.Run("span is missing", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertSpanExists(stub, exp, "baz")
+		})
+		assert.Contain(t, logs, "baz")
+		assert.Contain(t, logs, "foo")
+		assert.Contain(t, logs, "bar")
+	})
+}
+
+func TestAssertSpanHasAttribute(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	_, span := NewTracerProvider(exp).Tracer("tracer").Start(context.Background(), "span",
+		trace.WithAttributes(attribute.String("http.method", "GET"), attribute.Int("http.status_code", 200)))
+	span.End()
+
+	spans := exp.ExportedSpans()
+	assert.Equal(t, 1, len(spans))
+
+	t.Run("span has the attribute with the value", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertSpanHasAttribute(stub, spans[0], "http.method", attribute.StringValue("GET"))
+			otelkit.AssertSpanHasAttribute(stub, spans[0], "http.status_code", attribute.IntValue(200))
+		})
+	})
+
+	t.Run("span has the attribute with a different value", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertSpanHasAttribute(stub, spans[0], "http.method", attribute.StringValue("POST"))
+		})
+		assert.Contain(t, logs, "POST")
+		assert.Contain(t, logs, "GET")
+	})
+
+	t.Run("span lacks the attribute", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertSpanHasAttribute(stub, spans[0], "http.route", attribute.StringValue("/"))
+		})
+		assert.Contain(t, logs, "http.route")
+		assert.Contain(t, logs, "http.method")
+		assert.Contain(t, logs, "http.status_code")
+	})
+}
+
+func TestAssertRecordedError(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tracer := NewTracerProvider(exp).Tracer("tracer")
+
+	_, span := tracer.Start(context.Background(), "with-error")
+	span.RecordError(errors.New("connection refused"))
+	span.End()
+	_, span = tracer.Start(context.Background(), "without-error")
+	span.AddEvent("not-an-exception")
+	span.End()
+
+	spans := exp.ExportedSpans()
+	assert.Equal(t, 2, len(spans))
+
+	t.Run("exception event with matching message", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertRecordedError(stub, spans[0], "refused")
+		})
+	})
+
+	t.Run("exception event with different message", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertRecordedError(stub, spans[0], "timeout")
+		})
+		assert.Contain(t, logs, "connection refused")
+	})
+
+	t.Run("no exception event", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertRecordedError(stub, spans[1], "refused")
+		})
+		assert.Contain(t, logs, "no exception event")
+	})
+}
+
+func TestAssertChildOfContext(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tracer := NewTracerProvider(exp).Tracer("tracer")
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	parent.End()
+	otherCtx, _ := MakeTestSpanContext(nil)
+
+	spans := exp.ExportedSpans()
+	assert.Equal(t, 2, len(spans))
+
+	t.Run("span is the child of the context span", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertChildOfContext(stub, ctx, spans[0])
+		})
+	})
+
+	t.Run("span is the child of a different span", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertChildOfContext(stub, otherCtx, spans[0])
+		})
+		assert.Contain(t, logs, parent.SpanContext().SpanID().String())
+	})
+
+	t.Run("span is a root span", func(t *testing.T) {
+		assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertChildOfContext(stub, ctx, spans[1])
+		})
+	})
+
+	t.Run("context has no span", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertChildOfContext(stub, context.Background(), spans[0])
+		})
+		assert.Contain(t, logs, "valid span context")
+	})
+}
+
+func TestAssertNextReceivesTracedContext(t *testing.T) {
+	tracer := NewTracerProvider(&otelkit.FakeSpanExporter{}).Tracer("tracer")
+
+	t.Run("tracing middleware forwards the span context", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertNextReceivesTracedContext(stub, func(next http.Handler) http.Handler {
+				return otelkit.HTTPMiddlewareTracing{Next: next, Propagator: propagation.TraceContext{}, Tracer: tracer}
+			}, httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	})
+
+	t.Run("context middleware forwards the span context of the request", func(t *testing.T) {
+		ctx, _ := MakeTestSpanContext(nil)
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertNextReceivesTracedContext(stub, func(next http.Handler) http.Handler {
+				return otelkit.HTTPMiddlewareWithContext{Next: next}
+			}, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		})
+	})
+
+	t.Run("middleware drops the span context", func(t *testing.T) {
+		ctx, _ := MakeTestSpanContext(nil)
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertNextReceivesTracedContext(stub, func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, r.WithContext(context.Background()))
+				})
+			}, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		})
+		assert.Contain(t, logs, "valid span context")
+	})
+
+	t.Run("middleware doesn't call the next handler", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertNextReceivesTracedContext(stub, func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			}, httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+		assert.Contain(t, logs, "next handler to be called")
+	})
+}
+
+func TestAssertChildOf(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tracer := NewTracerProvider(exp).Tracer("tracer")
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	ctx, child := tracer.Start(ctx, "child")
+	_, grandchild := tracer.Start(ctx, "grandchild")
+	_, other := tracer.Start(context.Background(), "other")
+	for _, span := range []trace.Span{grandchild, child, parent, other} {
+		span.End()
+	}
+
+	spans := exp.ExportedSpans()
+	assert.Equal(t, 4, len(spans))
+	grandchildSpan, childSpan, parentSpan, otherSpan := spans[0], spans[1], spans[2], spans[3]
+
+	t.Run("direct child", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertChildOf(stub, childSpan, parentSpan)
+		})
+	})
+
+	t.Run("span of a different trace", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertChildOf(stub, otherSpan, parentSpan)
+		})
+		assert.Contain(t, logs, "different traces")
+		assert.Contain(t, logs, parentSpan.SpanContext().TraceID().String())
+		assert.Contain(t, logs, otherSpan.SpanContext().TraceID().String())
+	})
+
+	t.Run("descendant of the same trace, but not a direct child", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertChildOf(stub, grandchildSpan, parentSpan)
+		})
+		assert.Contain(t, logs, childSpan.SpanContext().SpanID().String())
+	})
+}
+
+func TestAssertSpanLacksAttribute(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	_, span := NewTracerProvider(exp).Tracer("tracer").Start(context.Background(), "span",
+		trace.WithAttributes(attribute.String("http.request.header.authorization", "Bearer secret")))
+	span.End()
+
+	spans := exp.ExportedSpans()
+	assert.Equal(t, 1, len(spans))
+
+	t.Run("span lacks the attribute", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertSpanLacksAttribute(stub, spans[0], "http.request.header.cookie")
+		})
+	})
+
+	t.Run("span has the forbidden attribute", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertSpanLacksAttribute(stub, spans[0], "http.request.header.authorization")
+		})
+		assert.Contain(t, logs, "http.request.header.authorization")
+		assert.NotContain(t, logs, "secret", "the forbidden value is not leaked into the test output")
+	})
+}
+
+func TestAssertSpanKind(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tracerProvider := NewTracerProvider(exp)
+
+	_, err := otelkit.HTTPRoundTripper{
+		Next:       &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}},
+		Propagator: propagation.TraceContext{},
+		Tracer:     tracerProvider.Tracer("tracer"),
+	}.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	otelkit.HTTPMiddlewareTracing{
+		Next:       http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		Propagator: propagation.TraceContext{},
+		Tracer:     tracerProvider.Tracer("tracer"),
+	}.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	spans := exp.ExportedSpans()
+	assert.Equal(t, 2, len(spans))
+
+	t.Run("round tripper span is of client kind", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertSpanKind(stub, spans[0], trace.SpanKindClient)
+		})
+	})
+
+	t.Run("server middleware span is of server kind", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertSpanKind(stub, spans[1], trace.SpanKindServer)
+		})
+	})
+
+	t.Run("different kind", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertSpanKind(stub, spans[0], trace.SpanKindServer)
+		})
+		assert.Contain(t, logs, trace.SpanKindClient.String())
+	})
+}
+
+func TestAssertMissingHeaders(t *testing.T) {
+	event := otelkit.NoTracingWarningEvent{MissingHeaders: []string{"traceparent", "baggage"}}
+
+	t.Run("same headers in different order", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertMissingHeaders(stub, event, "baggage", "Traceparent")
+		})
+	})
+
+	t.Run("subset of the headers", func(t *testing.T) {
+		logs := assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertMissingHeaders(stub, event, "traceparent")
+		})
+		assert.Contain(t, logs, "baggage")
+	})
+
+	t.Run("superset of the headers", func(t *testing.T) {
+		assertFails(t, func(stub *testcase.StubTB) {
+			otelkit.AssertMissingHeaders(stub, event, "traceparent", "baggage", "tracestate")
+		})
+	})
+
+	t.Run("no missing headers", func(t *testing.T) {
+		assertPasses(t, func(stub *testcase.StubTB) {
+			otelkit.AssertMissingHeaders(stub, otelkit.NoTracingWarningEvent{})
+		})
+	})
+}
@@ -0,0 +1,42 @@
+package otelkit
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ClientRequestSpanName is the span name of an outbound request that may take multiple attempts.
+	ClientRequestSpanName = "http.client.request"
+	// ClientAttemptSpanName is the span name of the individual attempts of an outbound request.
+	ClientAttemptSpanName = "http.client.attempt"
+)
+
+const attemptKey = attribute.Key("otelkit.http.attempt")
+
+// StartAttemptSpan starts the span of the nth attempt of the request, as the child of the request span in ctx.
+// The span is made with the TracerProvider of the request span, or with the global one when ctx has no span.
+//
+// To make the retries visible in the traces, HTTPRoundTripper starts the request span,
+// and the retrying transport that it wraps starts a span for each attempt:
+//
+//	otelkit.HTTPRoundTripper{
+//		SpanNameFn: func(*http.Request) string { return otelkit.ClientRequestSpanName },
+//		Next: RetryingTransport{Do: func(r *http.Request, n int) (*http.Response, error) {
+//			ctx, span := otelkit.StartAttemptSpan(r.Context(), n)
+//			defer span.End()
+//			return http.DefaultTransport.RoundTrip(r.WithContext(ctx))
+//		}},
+//	}
+func StartAttemptSpan(ctx context.Context, n int) (context.Context, trace.Span) {
+	tp := otel.GetTracerProvider()
+	if parent := trace.SpanFromContext(ctx); parent.SpanContext().IsValid() {
+		tp = parent.TracerProvider()
+	}
+	return tp.Tracer(instrumentationName, trace.WithInstrumentationVersion(Version)).
+		Start(ctx, ClientAttemptSpanName,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attemptKey.Int(n)))
+}
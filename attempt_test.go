@@ -0,0 +1,67 @@
+package otelkit_test
+
+import (
+	"context"
+	"errors"
+	"github.com/adamluzsi/otelkit"
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStartAttemptSpan(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	var attempts int
+	retrying := RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		var err error
+		for n := 1; n <= 3; n++ {
+			_, span := otelkit.StartAttemptSpan(r.Context(), n)
+			attempts++
+			if n < 3 {
+				err = errors.New("connection reset")
+				span.RecordError(err)
+				span.End()
+				continue
+			}
+			span.End()
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}
+		return nil, err
+	})
+
+	_, err := otelkit.HTTPRoundTripper{
+		Next:       retrying,
+		Propagator: propagation.TraceContext{},
+		Tracer:     NewTracerProvider(exp).Tracer("tracer"),
+		SpanNameFn: func(*http.Request) string { return otelkit.ClientRequestSpanName },
+	}.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	spans := exp.ExportedSpans()
+	assert.Equal(t, 4, len(spans), "3 attempt spans and the request span")
+	requestSpan := spans[3]
+	assert.Equal(t, otelkit.ClientRequestSpanName, requestSpan.Name())
+	requestCtx := trace.ContextWithSpanContext(context.Background(), requestSpan.SpanContext())
+	for i, attempt := range spans[:3] {
+		assert.Equal(t, otelkit.ClientAttemptSpanName, attempt.Name())
+		otelkit.AssertSpanKind(t, attempt, trace.SpanKindClient)
+		otelkit.AssertChildOfContext(t, requestCtx, attempt)
+		n, ok := spanAttribute(attempt, "otelkit.http.attempt")
+		assert.True(t, ok)
+		assert.Equal(t, int64(i+1), n.AsInt64())
+	}
+
+	t.Run("without a request span", func(t *testing.T) {
+		stub := otelkit.Stub(t)
+		_, span := otelkit.StartAttemptSpan(context.Background(), 1)
+		span.End()
+
+		spans := stub.SpanExporter.ExportedSpans()
+		assert.Equal(t, 1, len(spans), "the global tracer provider is used")
+		assert.False(t, spans[0].Parent().IsValid())
+	})
+}
@@ -0,0 +1,98 @@
+package otelkit
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ContextWithoutBaggage removes the members with the given keys from the baggage of the context,
+// e.g. to drop internal-only members before an external call.
+// Keys that are not present are ignored.
+func ContextWithoutBaggage(ctx context.Context, keys ...string) context.Context {
+	b := baggage.FromContext(ctx)
+	for _, key := range keys {
+		b = b.DeleteMember(key)
+	}
+	return baggage.ContextWithBaggage(ctx, b)
+}
+
+// BaggageToMap returns the values of the baggage members of the context by their keys, ignoring their properties.
+// The map is empty, but not nil, when the context has no baggage.
+func BaggageToMap(ctx context.Context) map[string]string {
+	members := baggage.FromContext(ctx).Members()
+	m := make(map[string]string, len(members))
+	for _, member := range members {
+		m[member.Key()] = member.Value()
+	}
+	return m
+}
+
+// BaggageSpanProcessor copies the baggage members found in the parent context onto each started span as attributes.
+//
+//	traceSDK.NewTracerProvider(traceSDK.WithSpanProcessor(otelkit.BaggageSpanProcessor{Prefix: "baggage."}))
+type BaggageSpanProcessor struct {
+	// Prefix is prepended to the baggage member keys to form the attribute keys.
+	Prefix string
+}
+
+func (p BaggageSpanProcessor) OnStart(parent context.Context, s traceSDK.ReadWriteSpan) {
+	for _, member := range baggage.FromContext(parent).Members() {
+		s.SetAttributes(attribute.String(p.Prefix+member.Key(), member.Value()))
+	}
+}
+
+func (p BaggageSpanProcessor) OnEnd(traceSDK.ReadOnlySpan) {}
+
+func (p BaggageSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (p BaggageSpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// HTTPMiddlewareBaggageToSpan copies the allowed baggage members of the request context
+// onto the span of the request context as attributes, keeping their keys, before calling Next.
+// Only the members listed in Allowlist are copied, so nothing is copied when it's empty,
+// which keeps sensitive baggage members out of the trace backends by default.
+type HTTPMiddlewareBaggageToSpan struct {
+	Next      http.Handler
+	Allowlist []string
+}
+
+func (mw HTTPMiddlewareBaggageToSpan) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := baggage.FromContext(r.Context())
+	var attrs []attribute.KeyValue
+	for _, key := range mw.Allowlist {
+		if member := b.Member(key); member.Key() != "" {
+			attrs = append(attrs, attribute.String(member.Key(), member.Value()))
+		}
+	}
+	if 0 < len(attrs) {
+		trace.SpanFromContext(r.Context()).SetAttributes(attrs...)
+	}
+	mw.Next.ServeHTTP(w, r)
+}
+
+// ExperimentBaggagePrefix is the prefix of the baggage member keys that ExperimentAttributes treats as experiment ids,
+// e.g. "experiment.checkout-button" with "variant-b" as its value.
+const ExperimentBaggagePrefix = "experiment."
+
+// ExperimentAttributes returns the experiment baggage members of the context as span attributes,
+// keeping their keys, like "experiment.checkout-button", and values.
+// It fits into the ContextAttributesFn of HTTPRoundTripper:
+//
+//	otelkit.HTTPRoundTripper{Next: http.DefaultTransport, ContextAttributesFn: otelkit.ExperimentAttributes}
+func ExperimentAttributes(ctx context.Context) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, member := range baggage.FromContext(ctx).Members() {
+		if !strings.HasPrefix(member.Key(), ExperimentBaggagePrefix) {
+			continue
+		}
+		attrs = append(attrs, attribute.String(member.Key(), member.Value()))
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
@@ -0,0 +1,220 @@
+package otelkit_test
+
+import (
+	"context"
+	"github.com/adamluzsi/otelkit"
+	"github.com/adamluzsi/testcase"
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextWithBaggage_order(t *testing.T) {
+	first, err := baggage.NewMember("key", "first", mustKeyProperty(t, "first-property"))
+	assert.NoError(t, err)
+	second, err := baggage.NewMember("key", "second")
+	assert.NoError(t, err)
+	other, err := baggage.NewMember("other", "value")
+	assert.NoError(t, err)
+
+	ctx, err := otelkit.ContextWithBaggage(context.Background(), first, other, second)
+	assert.NoError(t, err)
+
+	b := baggage.FromContext(ctx)
+	assert.Equal(t, 2, b.Len())
+	assert.Equal(t, "second", b.Member("key").Value())
+	assert.Empty(t, b.Member("key").Properties(), "the later member replaces the earlier one with its properties")
+	assert.Equal(t, "value", b.Member("other").Value())
+
+	ctx, err = otelkit.ContextWithBaggage(ctx, func() (baggage.Member, error) { return first, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, "first", baggage.FromContext(ctx).Member("key").Value(),
+		"members override the ones already present in the context")
+}
+
+func TestContextWithoutBaggage(t *testing.T) {
+	internal, err := baggage.NewMember("internal", "secret")
+	assert.NoError(t, err)
+	tenant, err := baggage.NewMember("tenant", "42")
+	assert.NoError(t, err)
+	ctx, err := otelkit.ContextWithBaggage(context.Background(), internal, tenant)
+	assert.NoError(t, err)
+
+	t.Run("listed members are removed", func(t *testing.T) {
+		b := baggage.FromContext(otelkit.ContextWithoutBaggage(ctx, "internal"))
+		assert.Equal(t, 1, b.Len())
+		assert.Empty(t, b.Member("internal").Key())
+		assert.Equal(t, "42", b.Member("tenant").Value())
+	})
+
+	t.Run("missing keys are ignored", func(t *testing.T) {
+		b := baggage.FromContext(otelkit.ContextWithoutBaggage(ctx, "unknown"))
+		assert.Equal(t, 2, b.Len())
+	})
+
+	t.Run("the original context is left intact", func(t *testing.T) {
+		otelkit.ContextWithoutBaggage(ctx, "internal", "tenant")
+		assert.Equal(t, 2, baggage.FromContext(ctx).Len())
+	})
+}
+
+func TestBaggageToMap(t *testing.T) {
+	t.Run("members are returned by their keys", func(t *testing.T) {
+		tenant, err := baggage.NewMember("tenant", "42", mustKeyProperty(t, "internal"))
+		assert.NoError(t, err)
+		region, err := baggage.NewMember("region", "eu")
+		assert.NoError(t, err)
+		ctx, err := otelkit.ContextWithBaggage(context.Background(), tenant, region)
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]string{"tenant": "42", "region": "eu"}, otelkit.BaggageToMap(ctx))
+	})
+
+	t.Run("without baggage", func(t *testing.T) {
+		m := otelkit.BaggageToMap(context.Background())
+		assert.NotNil(t, m)
+		assert.Empty(t, m)
+	})
+}
+
+func mustKeyProperty(tb testing.TB, key string) baggage.Property {
+	p, err := baggage.NewKeyProperty(key)
+	assert.NoError(tb, err)
+	return p
+}
+
+func TestBaggageSpanProcessor(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tp := traceSDK.NewTracerProvider(
+		traceSDK.WithSpanProcessor(otelkit.BaggageSpanProcessor{Prefix: "baggage."}),
+		traceSDK.WithSpanProcessor(traceSDK.NewSimpleSpanProcessor(exp)))
+
+	member, err := baggage.NewMember("tenant_id", "42")
+	assert.NoError(t, err)
+	ctx, err := otelkit.ContextWithBaggage(context.Background(), member)
+	assert.NoError(t, err)
+
+	_, span := tp.Tracer("tracer").Start(ctx, "with-baggage")
+	span.End()
+	_, span = tp.Tracer("tracer").Start(context.Background(), "without-baggage")
+	span.End()
+
+	spans := exp.ExportedSpans()
+	assert.Equal(t, 2, len(spans))
+
+	value, ok := spanAttribute(spans[0], "baggage.tenant_id")
+	assert.True(t, ok)
+	assert.Equal(t, "42", value.AsString())
+	assert.Empty(t, spans[1].Attributes())
+}
+
+func TestExperimentAttributes(t *testing.T) {
+	t.Run("experiment members are returned as attributes", func(t *testing.T) {
+		checkout, err := baggage.NewMember("experiment.checkout-button", "variant-b")
+		assert.NoError(t, err)
+		search, err := baggage.NewMember("experiment.search", "control")
+		assert.NoError(t, err)
+		tenant, err := baggage.NewMember("tenant", "acme")
+		assert.NoError(t, err)
+		ctx, err := otelkit.ContextWithBaggage(context.Background(), tenant, search, checkout)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []attribute.KeyValue{
+			attribute.String("experiment.checkout-button", "variant-b"),
+			attribute.String("experiment.search", "control"),
+		}, otelkit.ExperimentAttributes(ctx))
+	})
+
+	t.Run("without experiment members", func(t *testing.T) {
+		assert.Empty(t, otelkit.ExperimentAttributes(context.Background()))
+	})
+
+	t.Run("as the context attributes of the round tripper", func(t *testing.T) {
+		member, err := baggage.NewMember("experiment.checkout-button", "variant-b")
+		assert.NoError(t, err)
+		ctx, err := otelkit.ContextWithBaggage(context.Background(), member)
+		assert.NoError(t, err)
+
+		exp := &otelkit.FakeSpanExporter{}
+		_, err = otelkit.HTTPRoundTripper{
+			Next:                &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}},
+			Propagator:          propagation.TraceContext{},
+			Tracer:              NewTracerProvider(exp).Tracer("tracer"),
+			ContextAttributesFn: otelkit.ExperimentAttributes,
+		}.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		assert.NoError(t, err)
+
+		spans := exp.ExportedSpans()
+		assert.Equal(t, 1, len(spans))
+		value, ok := spanAttribute(spans[0], "experiment.checkout-button")
+		assert.True(t, ok)
+		assert.Equal(t, "variant-b", value.AsString())
+	})
+}
+
+func TestHTTPMiddlewareBaggageToSpan_ServeHTTP(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	allowlist := testcase.LetValue[[]string](s, nil)
+	span := testcase.Let(s, func(t *testcase.T) trace.Span {
+		tenant, err := baggage.NewMember("tenant", "42")
+		t.Must.Nil(err)
+		secret, err := baggage.NewMember("secret", "password")
+		t.Must.Nil(err)
+		ctx, err := otelkit.ContextWithBaggage(request.Get(t).Context(), tenant, secret)
+		t.Must.Nil(err)
+		ctx, span := tracer.Get(t).Start(ctx, exampleSpanName.Get(t))
+		request.Set(t, request.Get(t).WithContext(ctx))
+		return span
+	})
+	makeSubject := func(t *testcase.T, next http.Handler) http.Handler {
+		return otelkit.HTTPMiddlewareBaggageToSpan{
+			Next:      next,
+			Allowlist: allowlist.Get(t),
+		}
+	}
+	act := func(t *testcase.T) traceSDK.ReadOnlySpan {
+		span.Get(t)
+		makeSubject(t, stubHandler.Get(t)).ServeHTTP(responseRecorder.Get(t), request.Get(t))
+		span.Get(t).End()
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spans[0]
+	}
+
+	ItBehavesLikeAMiddleware(s, makeSubject)
+
+	s.Then("nothing is copied by default", func(t *testcase.T) {
+		got := act(t)
+
+		otelkit.AssertSpanLacksAttribute(t, got, "tenant")
+		otelkit.AssertSpanLacksAttribute(t, got, "secret")
+	})
+
+	s.When("baggage keys are allowed", func(s *testcase.Spec) {
+		allowlist.Let(s, func(t *testcase.T) []string {
+			return []string{"tenant", "region"}
+		})
+
+		s.Then("the present allowed members are copied onto the span", func(t *testcase.T) {
+			got := act(t)
+
+			otelkit.AssertSpanHasAttribute(t, got, "tenant", attribute.StringValue("42"))
+		})
+
+		s.Then("the absent allowed members are not set", func(t *testcase.T) {
+			otelkit.AssertSpanLacksAttribute(t, act(t), "region")
+		})
+
+		s.Then("the members that are not allowed are not copied", func(t *testcase.T) {
+			otelkit.AssertSpanLacksAttribute(t, act(t), "secret")
+		})
+	})
+}
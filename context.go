@@ -0,0 +1,36 @@
+package otelkit
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// SpanIDs returns the hex encoded trace and span id of the span context in ctx.
+// When the context has no valid span context, it returns empty strings and false.
+func SpanIDs(ctx context.Context) (traceID string, spanID string, ok bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", "", false
+	}
+	return sc.TraceID().String(), sc.SpanID().String(), true
+}
+
+// DetachedContext returns a context that carries the span context and the baggage of ctx,
+// but it is not cancelled when ctx is, and it has no deadline.
+// It is meant for background work that outlives the request, but should still belong to its trace.
+func DetachedContext(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+func (ctx detachedContext) Value(key any) any { return ctx.parent.Value(key) }
@@ -0,0 +1,63 @@
+package otelkit_test
+
+import (
+	"context"
+	"github.com/adamluzsi/otelkit"
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+	"time"
+)
+
+func TestSpanIDs(t *testing.T) {
+	t.Run("with span context", func(t *testing.T) {
+		ctx, sc := MakeTestSpanContext(nil)
+
+		traceID, spanID, ok := otelkit.SpanIDs(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, sc.TraceID().String(), traceID)
+		assert.Equal(t, sc.SpanID().String(), spanID)
+	})
+
+	t.Run("without span context", func(t *testing.T) {
+		traceID, spanID, ok := otelkit.SpanIDs(context.Background())
+		assert.False(t, ok)
+		assert.Empty(t, traceID)
+		assert.Empty(t, spanID)
+	})
+
+	t.Run("with invalid span context", func(t *testing.T) {
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.SpanContext{})
+		_, _, ok := otelkit.SpanIDs(ctx)
+		assert.False(t, ok)
+	})
+}
+
+func TestDetachedContext(t *testing.T) {
+	ctx, sc := MakeTestSpanContext(nil)
+	member, err := baggage.NewMember("key", "value")
+	assert.NoError(t, err)
+	ctx, err = otelkit.ContextWithBaggage(ctx, member)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(ctx, time.Hour)
+
+	detached := otelkit.DetachedContext(ctx)
+	cancel()
+	assert.ErrorIs(t, context.Canceled, ctx.Err())
+
+	t.Run("cancellation of the parent is not inherited", func(t *testing.T) {
+		assert.Nil(t, detached.Err())
+		assert.Nil(t, detached.Done())
+		_, ok := detached.Deadline()
+		assert.False(t, ok)
+	})
+
+	t.Run("span context is preserved", func(t *testing.T) {
+		assert.Equal(t, sc, trace.SpanContextFromContext(detached))
+	})
+
+	t.Run("baggage is preserved", func(t *testing.T) {
+		otelkit.AssertBaggage(t, detached, "key", "value")
+	})
+}
@@ -0,0 +1,48 @@
+package otelkit
+
+import (
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DebugRoundTripper is meant for local development.
+// It traces the outbound requests with the global TracerProvider and the DefaultPropagator just like HTTPRoundTripper,
+// and additionally logs the method, URL, status and duration of every request with logf.
+func DebugRoundTripper(next http.RoundTripper, logf func(format string, args ...any)) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return HTTPRoundTripper{Next: debugLogRoundTripper{Next: next, Logf: logf}}
+}
+
+type debugLogRoundTripper struct {
+	Next http.RoundTripper
+	Logf func(format string, args ...any)
+}
+
+func (rt debugLogRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := rt.Next.RoundTrip(request)
+	duration := time.Since(start)
+	if err != nil {
+		rt.Logf("%s %s error: %v (%s)", request.Method, request.URL.String(), err, duration)
+		return response, err
+	}
+	rt.Logf("%s %s %d (%s)", request.Method, request.URL.String(), response.StatusCode, duration)
+	return response, err
+}
+
+// NewPrettySpanExporter makes a span exporter that writes the spans to w in the human-readable format of DebugSpanExporter.
+// It's meant for local debugging of an application, e.g. with os.Stderr as w.
+func NewPrettySpanExporter(w io.Writer) (traceSDK.SpanExporter, error) {
+	return stdouttrace.New(
+		stdouttrace.WithWriter(w),
+		// Use human-readable output.
+		stdouttrace.WithPrettyPrint(),
+		// Do not print timestamps for the demo.
+		stdouttrace.WithoutTimestamps(),
+	)
+}
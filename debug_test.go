@@ -0,0 +1,68 @@
+package otelkit_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/adamluzsi/otelkit"
+	"github.com/adamluzsi/testcase/assert"
+	"github.com/adamluzsi/testcase/random"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugRoundTripper(t *testing.T) {
+	rnd := random.New(random.CryptoSeed{})
+
+	t.Run("happy", func(t *testing.T) {
+		stub := otelkit.Stub(t)
+		next := &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusTeapot}}
+		var logs []string
+		rt := otelkit.DebugRoundTripper(next, func(format string, args ...any) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "https://example.com/"+rnd.StringNC(5, random.CharsetAlpha()), nil)
+		resp, err := rt.RoundTrip(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+
+		assert.Equal(t, 1, len(logs))
+		assert.Contain(t, logs[0], http.MethodPost)
+		assert.Contain(t, logs[0], req.URL.String())
+		assert.Contain(t, logs[0], "418")
+		assert.Equal(t, 1, len(stub.SpanExporter.ExportedSpans()))
+	})
+
+	t.Run("rainy", func(t *testing.T) {
+		otelkit.Stub(t)
+		expErr := rnd.Error()
+		next := &StubRoundTripper{Err: expErr}
+		var logs []string
+		rt := otelkit.DebugRoundTripper(next, func(format string, args ...any) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		})
+
+		_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+		assert.ErrorIs(t, expErr, err)
+		assert.Equal(t, 1, len(logs))
+		assert.Contain(t, logs[0], expErr.Error())
+	})
+}
+
+func TestNewPrettySpanExporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	exp, err := otelkit.NewPrettySpanExporter(buf)
+	assert.NoError(t, err)
+	tp := NewTracerProvider(exp)
+
+	_, span := tp.Tracer("TracerName").Start(context.Background(), "SpanName")
+	span.AddEvent("EventName")
+	span.End()
+	assert.NoError(t, tp.Shutdown(context.Background()))
+
+	assert.Contain(t, buf.String(), "TracerName")
+	assert.Contain(t, buf.String(), "SpanName")
+	assert.Contain(t, buf.String(), "EventName")
+}
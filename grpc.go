@@ -0,0 +1,102 @@
+package otelkit
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// UnaryServerInterceptor traces the unary RPCs of a gRPC server with a server span named after the full method,
+// continuing the trace extracted from the incoming metadata, and records the RPC status code on the span.
+//
+//	grpc.NewServer(grpc.UnaryInterceptor(otelkit.UnaryServerInterceptor{}.Intercept))
+type UnaryServerInterceptor struct {
+	// Propagator is used to extract the tracing from the incoming metadata.
+	// When it's nil, DefaultPropagator is used.
+	Propagator propagation.TextMapPropagator
+	// Tracer starts the server spans.
+	// When it's nil, the global TracerProvider is used.
+	Tracer trace.Tracer
+	// WithContextFn is called with the span context of the server span before the handler,
+	// just like the WithContextFn of HTTPMiddlewareWithContext, and the handler receives the context it returns.
+	WithContextFn func(context.Context, trace.SpanContext) context.Context
+}
+
+func (i UnaryServerInterceptor) Intercept(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = i.propagator().Extract(ctx, metadataCarrier(md))
+
+	ctx, span := i.tracer().Start(ctx, info.FullMethod,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(rpcAttributes(info.FullMethod)...))
+	defer span.End()
+
+	if i.WithContextFn != nil {
+		ctx = i.WithContextFn(ctx, span.SpanContext())
+	}
+
+	resp, err := handler(ctx, req)
+	st, _ := status.FromError(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int64(int64(st.Code())))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, st.Message())
+	}
+	return resp, err
+}
+
+func (i UnaryServerInterceptor) propagator() propagation.TextMapPropagator {
+	if i.Propagator != nil {
+		return i.Propagator
+	}
+	return DefaultPropagator()
+}
+
+func (i UnaryServerInterceptor) tracer() trace.Tracer {
+	if i.Tracer != nil {
+		return i.Tracer
+	}
+	return otel.GetTracerProvider().Tracer(instrumentationName, trace.WithInstrumentationVersion(Version))
+}
+
+// rpcAttributes splits the full method, like "/package.Service/Method", into the rpc.service and rpc.method attributes.
+func rpcAttributes(fullMethod string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.RPCSystemKey.String("grpc")}
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return attrs
+	}
+	return append(attrs, semconv.RPCServiceKey.String(service), semconv.RPCMethodKey.String(method))
+}
+
+// metadataCarrier adapts the gRPC metadata to a propagation.TextMapCarrier.
+// The metadata keys are lower case, just like the propagators' fields.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
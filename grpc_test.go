@@ -0,0 +1,107 @@
+package otelkit_test
+
+import (
+	"context"
+	"github.com/adamluzsi/otelkit"
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpcCodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/users.v1.UserService/GetUser"}
+	incomingContext := func(t *testing.T) (context.Context, trace.SpanContext) {
+		ctx, sc := MakeTestSpanContext(nil)
+		carrier := propagation.MapCarrier{}
+		propagation.TraceContext{}.Inject(ctx, carrier)
+		return metadata.NewIncomingContext(context.Background(), metadata.New(carrier)), sc
+	}
+
+	t.Run("the server span continues the trace of the incoming metadata", func(t *testing.T) {
+		exp := &otelkit.FakeSpanExporter{}
+		ctx, parent := incomingContext(t)
+
+		var handled context.Context
+		resp, err := otelkit.UnaryServerInterceptor{
+			Propagator: propagation.TraceContext{},
+			Tracer:     NewTracerProvider(exp).Tracer("tracer"),
+		}.Intercept(ctx, "req", info, func(ctx context.Context, req any) (any, error) {
+			handled = ctx
+			return "resp", nil
+		})
+		assert.NoError(t, err)
+		assert.Equal[any](t, "resp", resp)
+
+		span := otelkit.AssertSpanExists(t, exp, info.FullMethod)
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+		assert.Equal(t, parent.TraceID(), span.SpanContext().TraceID())
+		assert.Equal(t, parent.SpanID(), span.Parent().SpanID())
+		assert.Equal(t, span.SpanContext(), trace.SpanContextFromContext(handled))
+		otelkit.AssertSpanHasAttribute(t, span, "rpc.system", attribute.StringValue("grpc"))
+		otelkit.AssertSpanHasAttribute(t, span, "rpc.service", attribute.StringValue("users.v1.UserService"))
+		otelkit.AssertSpanHasAttribute(t, span, "rpc.method", attribute.StringValue("GetUser"))
+		otelkit.AssertSpanHasAttribute(t, span, "rpc.grpc.status_code", attribute.Int64Value(int64(grpcCodes.OK)))
+		assert.Equal(t, codes.Unset, span.Status().Code)
+	})
+
+	t.Run("the status code of a failed RPC is recorded", func(t *testing.T) {
+		exp := &otelkit.FakeSpanExporter{}
+		ctx, _ := incomingContext(t)
+
+		_, err := otelkit.UnaryServerInterceptor{
+			Tracer: NewTracerProvider(exp).Tracer("tracer"),
+		}.Intercept(ctx, "req", info, func(ctx context.Context, req any) (any, error) {
+			return nil, status.Error(grpcCodes.NotFound, "user not found")
+		})
+		assert.Equal(t, grpcCodes.NotFound, status.Code(err))
+
+		span := otelkit.AssertSpanExists(t, exp, info.FullMethod)
+		otelkit.AssertSpanHasAttribute(t, span, "rpc.grpc.status_code", attribute.Int64Value(int64(grpcCodes.NotFound)))
+		assert.Equal(t, codes.Error, span.Status().Code)
+		assert.Equal(t, "user not found", span.Status().Description)
+	})
+
+	t.Run("WithContextFn enriches the context of the handler", func(t *testing.T) {
+		type ctxKey struct{}
+		exp := &otelkit.FakeSpanExporter{}
+		ctx, _ := incomingContext(t)
+
+		var got trace.SpanContext
+		_, err := otelkit.UnaryServerInterceptor{
+			Propagator: propagation.TraceContext{},
+			Tracer:     NewTracerProvider(exp).Tracer("tracer"),
+			WithContextFn: func(ctx context.Context, sc trace.SpanContext) context.Context {
+				got = sc
+				return context.WithValue(ctx, ctxKey{}, sc.TraceID().String())
+			},
+		}.Intercept(ctx, "req", info, func(ctx context.Context, req any) (any, error) {
+			assert.Equal[any](t, trace.SpanContextFromContext(ctx).TraceID().String(), ctx.Value(ctxKey{}))
+			return nil, nil
+		})
+		assert.NoError(t, err)
+
+		span := otelkit.AssertSpanExists(t, exp, info.FullMethod)
+		assert.Equal(t, span.SpanContext(), got)
+	})
+
+	t.Run("without incoming metadata, a new trace is started", func(t *testing.T) {
+		exp := &otelkit.FakeSpanExporter{}
+
+		_, err := otelkit.UnaryServerInterceptor{
+			Tracer: NewTracerProvider(exp).Tracer("tracer"),
+		}.Intercept(context.Background(), "req", info, func(ctx context.Context, req any) (any, error) {
+			return nil, nil
+		})
+		assert.NoError(t, err)
+
+		span := otelkit.AssertSpanExists(t, exp, info.FullMethod)
+		assert.False(t, span.Parent().IsValid())
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/adamluzsi/otelkit"
 	"github.com/adamluzsi/testcase"
 	"github.com/adamluzsi/testcase/random"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
 	traceSDK "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
@@ -47,7 +48,9 @@ var (
 	stubSpanExporter = testcase.Var[*otelkit.FakeSpanExporter]{
 		ID: "FakeSpanExporter",
 		Init: func(t *testcase.T) *otelkit.FakeSpanExporter {
-			return &otelkit.FakeSpanExporter{}
+			exp := &otelkit.FakeSpanExporter{}
+			otelkit.RegisterSpanDump(t, exp)
+			return exp
 		},
 	}
 	tracerProvider = testcase.Var[trace.TracerProvider]{
@@ -138,3 +141,24 @@ func NewTracerProvider(spanExporter traceSDK.SpanExporter) *traceSDK.TracerProvi
 			traceSDK.NewSimpleSpanProcessor(
 				spanExporter)))
 }
+
+// exportedSpan returns the only span that reached the stubSpanExporter.
+func exportedSpan(t *testcase.T) traceSDK.ReadOnlySpan {
+	t.Helper()
+	spans := stubSpanExporter.Get(t).ExportedSpans()
+	t.Must.Equal(1, len(spans))
+	return spans[0]
+}
+
+func spanAttribute(span traceSDK.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return fn(r) }
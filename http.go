@@ -1,103 +1,1324 @@
 package otelkit
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"go.opentelemetry.io/otel/trace"
+	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
 )
 
 type HTTPMiddlewareWithContext struct {
-	Next          http.Handler
+	Next http.Handler
+	// WithContextFn is called with the valid span context of the request context.
+	// The middleware doesn't look at the inbound headers, so it's called for a locally started span
+	// even when the request had no tracing headers.
+	// When the request context only has a remote span context, extracted from the inbound headers,
+	// and no span was started locally, the received span context's IsRemote reports true.
 	WithContextFn func(context.Context, trace.SpanContext) context.Context
+	// WithContextErrFn is called just like WithContextFn, and after it, when both are set,
+	// but it can reject the request, e.g. when a required baggage member is missing.
+	// When it returns an error, the error is recorded on the span of the request context,
+	// the ErrorStatusCode is written as the response, and Next is not called.
+	WithContextErrFn func(context.Context, trace.SpanContext) (context.Context, error)
+	// ErrorStatusCode is the response status code when WithContextErrFn fails.
+	// By default, it is http.StatusInternalServerError.
+	ErrorStatusCode int
+	// SkipRemote makes WithContextFn only called with the span contexts of locally started spans.
+	SkipRemote bool
 }
 
 func (mw HTTPMiddlewareWithContext) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	sp := trace.SpanContextFromContext(ctx)
-	if sp.IsValid() && mw.WithContextFn != nil {
-		ctx = mw.WithContextFn(ctx, sp)
+	if sp.IsValid() && !(mw.SkipRemote && sp.IsRemote()) {
+		if mw.WithContextFn != nil {
+			ctx = mw.WithContextFn(ctx, sp)
+		}
+		if mw.WithContextErrFn != nil {
+			var err error
+			ctx, err = mw.WithContextErrFn(ctx, sp)
+			if err != nil {
+				mw.reject(w, r, err)
+				return
+			}
+		}
 	}
 	mw.Next.ServeHTTP(w, r.WithContext(ctx))
 }
 
+func (mw HTTPMiddlewareWithContext) reject(w http.ResponseWriter, r *http.Request, err error) {
+	span := trace.SpanFromContext(r.Context())
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	code := mw.ErrorStatusCode
+	if code == 0 {
+		code = http.StatusInternalServerError
+	}
+	w.WriteHeader(code)
+}
+
 type HTTPMiddlewareNoTracingWarning struct {
-	Next       http.Handler
+	Next http.Handler
+	// Propagator is used to extract the tracing from the request headers.
+	// When it's nil, DefaultPropagator is used.
+	// A composite propagator only makes a warning when none of its propagators can extract a valid span context,
+	// and the MissingHeaders of the warning is the union of the headers they looked up.
 	Propagator propagation.TextMapPropagator
-	NotifyFn   func(NoTracingWarningEvent)
+	// Propagators takes precedence over Propagator when it's not empty,
+	// and they are used together as a composite propagator,
+	// e.g. the TraceContext and a B3 propagator in a service that still receives B3 headers from older clients.
+	Propagators []propagation.TextMapPropagator
+	NotifyFn    func(NoTracingWarningEvent)
+	// RequiredHeaders lists header names that are expected on every request, in addition to the ones the propagator looks up,
+	// like the headers of a B3 or a composite propagator.
+	// When any of them is missing, the request is reported, even if the propagator found a valid span context,
+	// and the missing ones are merged in lower case into NoTracingWarningEvent.MissingHeaders.
+	RequiredHeaders []string
+	// SampleRate is the fraction of the requests without tracing that are passed to NotifyFn,
+	// which keeps the notifications of a busy service at bay.
+	// Every request is still forwarded to Next.
+	// When it's not between 0 and 1, exclusively, every request without tracing is notified.
+	SampleRate float64
+	// Meter is used to count the requests without tracing with the otelkit.http.missing_trace counter,
+	// regardless of SampleRate, which allows alerting on the propagation coverage.
+	// Requests with a valid span context are not counted, even when some of the RequiredHeaders are missing.
+	// The counter is labeled with the method, and the route when RouteFn is provided.
+	// When Meter is nil, no metric is recorded.
+	Meter   metric.Meter
+	RouteFn func(r *http.Request) string
+	// Semconv selects the semantic conventions of the counter's attributes.
+	// By default, it's SemconvV1_7.
+	Semconv SemconvVersion
 }
 
+const httpMissingTraceMetricName = "otelkit.http.missing_trace"
+
 type NoTracingWarningEvent struct {
 	MissingHeaders []string
-	Request        *http.Request
+	// Reason tells why the tracing of the request was considered missing.
+	Reason  NoTracingReason
+	Request *http.Request
 }
 
+type NoTracingReason string
+
+const (
+	// NoTracingReasonMissingHeaders means that the propagator couldn't find the tracing headers.
+	NoTracingReasonMissingHeaders NoTracingReason = "missing headers"
+	// NoTracingReasonZeroTraceID means that the traceparent header is present, but its trace id is all zero,
+	// which is invalid per the W3C Trace Context specification, and usually the sign of a misbehaving client library.
+	NoTracingReasonZeroTraceID NoTracingReason = "zero trace id"
+	// NoTracingReasonInvalid means that the tracing headers are present, but they don't form a valid span context.
+	NoTracingReasonInvalid NoTracingReason = "invalid span context"
+)
+
 func (mw HTTPMiddlewareNoTracingWarning) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	spy := &spyHeaderCarrier{HeaderCarrier: propagation.HeaderCarrier(r.Header)}
-	sp := trace.SpanContextFromContext(mw.Propagator.Extract(context.Background(), spy))
-	if !sp.IsValid() {
-		mw.notify(r, spy.MissingHeaders)
+	missingHeaders, reason, ok := detectNoTracing(mw.propagator(), r)
+	if ok {
+		mw.count(r)
+	}
+	if missingRequired := missingHeaderKeys(r.Header, mw.RequiredHeaders); 0 < len(missingRequired) {
+		for _, key := range missingRequired {
+			if !contains(missingHeaders, key) {
+				missingHeaders = append(missingHeaders, key)
+			}
+		}
+		if !ok {
+			reason, ok = NoTracingReasonMissingHeaders, true
+		}
+	}
+	if ok {
+		mw.notify(r, missingHeaders, reason)
 	}
 
 	mw.Next.ServeHTTP(w, r)
 }
 
-func (mw HTTPMiddlewareNoTracingWarning) notify(r *http.Request, missingHeaders []string) {
-	if mw.NotifyFn == nil {
+// missingHeaderKeys returns the lower case keys that have no value in the header.
+func missingHeaderKeys(header http.Header, keys []string) []string {
+	var missing []string
+	for _, key := range keys {
+		if header.Get(key) == "" {
+			missing = append(missing, strings.ToLower(key))
+		}
+	}
+	return missing
+}
+
+// detectNoTracing extracts the tracing from the request headers with the propagator,
+// and when there is no valid span context, it tells which headers were missing and why.
+func detectNoTracing(propagator propagation.TextMapPropagator, r *http.Request) (missingHeaders []string, reason NoTracingReason, ok bool) {
+	spy := &spyHeaderCarrier{HeaderCarrier: propagation.HeaderCarrier(r.Header)}
+	sp := trace.SpanContextFromContext(propagator.Extract(context.Background(), spy))
+	if sp.IsValid() {
+		return nil, "", false
+	}
+	return spy.MissingHeaders, spy.reason(), true
+}
+
+func (mw HTTPMiddlewareNoTracingWarning) propagator() propagation.TextMapPropagator {
+	if 0 < len(mw.Propagators) {
+		return propagation.NewCompositeTextMapPropagator(mw.Propagators...)
+	}
+	if mw.Propagator != nil {
+		return mw.Propagator
+	}
+	return DefaultPropagator()
+}
+
+func (mw HTTPMiddlewareNoTracingWarning) count(r *http.Request) {
+	if mw.Meter == nil {
+		return
+	}
+	counter, err := mw.Meter.Int64Counter(httpMissingTraceMetricName,
+		metric.WithUnit("{request}"),
+		metric.WithDescription("The number of inbound HTTP requests without tracing."))
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	httpAttrs := httpAttributes{version: mw.Semconv}
+	attrs := []attribute.KeyValue{httpAttrs.method(r.Method)}
+	if mw.RouteFn != nil {
+		if route := mw.RouteFn(r); route != "" {
+			attrs = append(attrs, httpAttrs.route(route))
+		}
+	}
+	counter.Add(r.Context(), 1, metric.WithAttributes(attrs...))
+}
+
+func (mw HTTPMiddlewareNoTracingWarning) sampled() bool {
+	if mw.SampleRate <= 0 || 1 <= mw.SampleRate {
+		return true
+	}
+	return rand.Float64() < mw.SampleRate
+}
+
+func (mw HTTPMiddlewareNoTracingWarning) notify(r *http.Request, missingHeaders []string, reason NoTracingReason) {
+	if mw.NotifyFn == nil || !mw.sampled() {
 		return
 	}
 	mw.NotifyFn(NoTracingWarningEvent{
 		MissingHeaders: missingHeaders,
+		Reason:         reason,
 		Request:        r.Clone(r.Context()),
 	})
 }
 
+// HTTPMiddlewareRequireTracing rejects the requests that arrive without tracing,
+// using the same detection as HTTPMiddlewareNoTracingWarning, and forwards the rest to Next.
+// It enforces the propagation of the tracing at trust boundaries.
+type HTTPMiddlewareRequireTracing struct {
+	Next http.Handler
+	// Propagator is used to extract the tracing from the request headers.
+	// When it's nil, DefaultPropagator is used.
+	Propagator propagation.TextMapPropagator
+	// StatusCode is the response status code of the rejected requests.
+	// By default, it's http.StatusBadRequest.
+	StatusCode int
+	// Body is the optional response body of the rejected requests.
+	Body []byte
+	// ExemptPaths lists the request paths that are forwarded even without tracing, like health checks.
+	ExemptPaths []string
+}
+
+func (mw HTTPMiddlewareRequireTracing) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if contains(mw.ExemptPaths, r.URL.Path) {
+		mw.Next.ServeHTTP(w, r)
+		return
+	}
+	if _, _, ok := detectNoTracing(mw.propagator(), r); ok {
+		mw.reject(w)
+		return
+	}
+	mw.Next.ServeHTTP(w, r)
+}
+
+func (mw HTTPMiddlewareRequireTracing) reject(w http.ResponseWriter) {
+	code := mw.StatusCode
+	if code == 0 {
+		code = http.StatusBadRequest
+	}
+	w.WriteHeader(code)
+	if len(mw.Body) > 0 {
+		_, _ = w.Write(mw.Body)
+	}
+}
+
+func (mw HTTPMiddlewareRequireTracing) propagator() propagation.TextMapPropagator {
+	if mw.Propagator != nil {
+		return mw.Propagator
+	}
+	return DefaultPropagator()
+}
+
 type spyHeaderCarrier struct {
 	propagation.HeaderCarrier
 	MissingHeaders []string
+	FoundHeaders   map[string]string
 }
 
+// Get looks up the header just like propagation.HeaderCarrier, which matches the keys case-insensitively,
+// so the recorded header keys are normalised to lower case for consistent reporting,
+// regardless of the casing a propagator uses for its header names.
 func (s *spyHeaderCarrier) Get(key string) string {
 	value := s.HeaderCarrier.Get(key)
+	key = strings.ToLower(key)
 	if value == "" {
-		s.MissingHeaders = append(s.MissingHeaders, key)
+		if !contains(s.MissingHeaders, key) {
+			s.MissingHeaders = append(s.MissingHeaders, key)
+		}
+		return value
 	}
+	if s.FoundHeaders == nil {
+		s.FoundHeaders = map[string]string{}
+	}
+	s.FoundHeaders[key] = value
 	return value
 }
 
-type HTTPRoundTripper struct {
-	Next       http.RoundTripper
+func contains(vs []string, v string) bool {
+	for _, o := range vs {
+		if o == v {
+			return true
+		}
+	}
+	return false
+}
+
+// reason tells why the extraction from the looked up headers failed.
+func (s *spyHeaderCarrier) reason() NoTracingReason {
+	if traceparent, ok := s.FoundHeaders[traceparentHeader]; ok && isZeroTraceParent(traceparent) {
+		return NoTracingReasonZeroTraceID
+	}
+	if 0 < len(s.MissingHeaders) {
+		return NoTracingReasonMissingHeaders
+	}
+	return NoTracingReasonInvalid
+}
+
+const traceparentHeader = "traceparent"
+
+func isZeroTraceParent(traceparent string) bool {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	return 2 <= len(parts) && parts[1] == zeroTraceID
+}
+
+var zeroTraceID = trace.TraceID{}.String()
+
+// HTTPMiddlewareRecovery records panics from the Next handler on the span found in the request context.
+//
+// The span always receives the error, regardless of RePanic.
+// When RePanic is true, the original panic value is raised again after the span is updated,
+// so an upstream recovery middleware (or the http.Server itself) still sees and handles it.
+// When RePanic is false, the panic is swallowed and a 500 Internal Server Error response is written,
+// which means upstream recovery middlewares won't know about it, so use NotifyFn for logging.
+//
+// The span must still be open while the panic unwinds,
+// so place this middleware inside the one that starts the span (e.g. otelhttp.NewHandler).
+type HTTPMiddlewareRecovery struct {
+	Next     http.Handler
+	RePanic  bool
+	NotifyFn func(RecoveryEvent)
+	// WithStackTrace records the stack trace of the panicking goroutine as the exception.stacktrace span attribute.
+	WithStackTrace bool
+}
+
+type RecoveryEvent struct {
+	Panic   any
+	Err     error
+	Request *http.Request
+}
+
+func (mw HTTPMiddlewareRecovery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		err := panicToError(v)
+		span := trace.SpanFromContext(r.Context())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if mw.WithStackTrace {
+			span.SetAttributes(semconv.ExceptionStacktraceKey.String(string(debug.Stack())))
+		}
+		mw.notify(r, v, err)
+		// http.ErrAbortHandler is a control flow signal for the http.Server, and not a real failure.
+		if mw.RePanic || v == http.ErrAbortHandler {
+			panic(v)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}()
+	mw.Next.ServeHTTP(w, r)
+}
+
+func (mw HTTPMiddlewareRecovery) notify(r *http.Request, v any, err error) {
+	if mw.NotifyFn == nil {
+		return
+	}
+	mw.NotifyFn(RecoveryEvent{
+		Panic:   v,
+		Err:     err,
+		Request: r.Clone(r.Context()),
+	})
+}
+
+func panicToError(v any) error {
+	if err, ok := v.(error); ok {
+		return err
+	}
+	return fmt.Errorf("panic: %v", v)
+}
+
+// HTTPMiddlewareTracing extracts the inbound tracing from the request headers,
+// and starts a server span that the Next handler receives in the request context.
+//
+// When Propagator is nil, DefaultPropagator is used, and when Tracer is nil, the global TracerProvider is used.
+type HTTPMiddlewareTracing struct {
+	Next       http.Handler
 	Propagator propagation.TextMapPropagator
 	Tracer     trace.Tracer
 	SpanNameFn func(r *http.Request) string
+	// RouteFn resolves the low-cardinality route template (e.g. "/users/{id}") of the request,
+	// which is recorded as the http.route attribute, independently of the span name.
+	RouteFn func(r *http.Request) string
+	// RecordQueryParams lists the query parameters that are recorded as http.request.query.<name> attributes.
+	// Only the allowed parameters are recorded, as string slices, including all the values of a repeated parameter.
+	RecordQueryParams []string
+	// UsePattern makes the http.ServeMux pattern of the request (Go 1.22+) used as the span name,
+	// and its path template, without the method and the host, as the http.route attribute,
+	// unless RouteFn or SpanNameFn is provided.
+	// The pattern is also picked up when the middleware wraps the ServeMux itself.
+	// When the request has no pattern, the span is named after the request path with its id-like segments replaced by "{id}".
+	UsePattern bool
+	// NewRootWithLink makes the server span the root of a new trace when the inbound request has a valid remote span context,
+	// and links the server span to the inbound span context instead of continuing its trace.
+	// This is for trust boundaries, where an external trace shouldn't be continued, but its reference is still valuable.
+	NewRootWithLink bool
+	// Semconv selects the semantic conventions of the recorded HTTP attributes.
+	// By default, it's SemconvV1_7.
+	Semconv SemconvVersion
+}
+
+const (
+	// samplingParentSampledKey tells if the inbound trace's flags were sampled by the caller.
+	samplingParentSampledKey = attribute.Key("otelkit.sampling.parent_sampled")
+	// samplingSampledKey tells if the local sampler sampled the span.
+	// It's false for the spans that a RecordOnly sampler keeps recording for the span processors without sampling them,
+	// and together with samplingParentSampledKey, it shows when the local decision differs from the caller's.
+	samplingSampledKey = attribute.Key("otelkit.sampling.sampled")
+)
+
+func (mw HTTPMiddlewareTracing) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := mw.propagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	var route string
+	if mw.RouteFn != nil {
+		route = mw.RouteFn(r)
+	} else if mw.UsePattern {
+		route = patternRoute(requestPattern(r))
+	}
+	attrs := httpAttributes{version: mw.Semconv}.server(withoutQuery(r, mw.RecordQueryParams), route)
+	attrs = append(attrs, queryParamAttributes(r.URL, mw.RecordQueryParams)...)
+	opts := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindServer)}
+	if parent := trace.SpanContextFromContext(ctx); parent.IsValid() && parent.IsRemote() {
+		attrs = append(attrs, samplingParentSampledKey.Bool(parent.IsSampled()))
+		if mw.NewRootWithLink {
+			opts = append(opts, trace.WithNewRoot(), trace.WithLinks(trace.Link{SpanContext: parent}))
+		}
+	}
+	opts = append(opts, trace.WithAttributes(attrs...))
+
+	spanName := defaultServerSpanName
+	if mw.SpanNameFn != nil {
+		spanName = mw.SpanNameFn(r)
+	} else if mw.UsePattern {
+		spanName = patternSpanName(r)
+	}
+
+	ctx, span := mw.tracer().Start(ctx, spanName, opts...)
+	defer span.End()
+	span.SetAttributes(samplingSampledKey.Bool(span.SpanContext().IsSampled()))
+
+	next := r.WithContext(ctx)
+	mw.Next.ServeHTTP(w, next)
+	if mw.UsePattern {
+		mw.recordRoutedPattern(span, r, next)
+	}
+}
+
+// recordRoutedPattern records the pattern when the middleware wraps the http.ServeMux itself,
+// since the ServeMux only sets the pattern on the request while routing it.
+func (mw HTTPMiddlewareTracing) recordRoutedPattern(span trace.Span, r, routed *http.Request) {
+	pattern := requestPattern(routed)
+	if pattern == "" || requestPattern(r) != "" {
+		return
+	}
+	if mw.RouteFn == nil {
+		span.SetAttributes(httpAttributes{version: mw.Semconv}.route(patternRoute(pattern)))
+	}
+	if mw.SpanNameFn == nil {
+		span.SetName(pattern)
+	}
+}
+
+// patternRoute strips the method and the host of a http.ServeMux pattern,
+// since the http.route attribute is the path template only,
+// e.g. "/users/{id}" for "GET example.com/users/{id}".
+func patternRoute(pattern string) string {
+	if i := strings.IndexAny(pattern, " \t"); 0 <= i {
+		pattern = strings.TrimSpace(pattern[i+1:])
+	}
+	if i := strings.Index(pattern, "/"); 0 < i {
+		pattern = pattern[i:]
+	}
+	return pattern
+}
+
+func patternSpanName(r *http.Request) string {
+	if pattern := requestPattern(r); pattern != "" {
+		return pattern
+	}
+	return sanitizePath(r.URL.Path)
+}
+
+// RouteSpanNameFn makes a SpanNameFn that names the spans after the first matching route template,
+// like "GET /users/{id}", which keeps the cardinality of the span names low.
+// The templates follow the syntax of the http.ServeMux patterns:
+//   - a "{name}" segment matches any single path segment, and a trailing "{name...}" segment matches the rest of the path,
+//   - a trailing slash, like "/static/", matches the whole subtree, unless the template ends with "{$}", like "/users/{$}",
+//   - an optional method prefix, like "POST /users", restricts the template to the requests with that method, and GET also matches HEAD,
+//   - an optional host prefix, like "api.example.com/users", restricts the template to the requests to that host.
+//
+// Unlike the http.ServeMux, the first matching template wins, not the most specific one.
+// When no template matches, the span is named after the method and the path with its id-like segments replaced with "{id}".
+//
+//	otelkit.HTTPRoundTripper{Next: http.DefaultTransport, SpanNameFn: otelkit.RouteSpanNameFn("/users/{id}", "/orders/{id}/items")}
+func RouteSpanNameFn(patterns ...string) func(r *http.Request) string {
+	routes := make([]routeTemplate, 0, len(patterns))
+	for _, pattern := range patterns {
+		routes = append(routes, parseRouteTemplate(pattern))
+	}
+	return func(r *http.Request) string {
+		for _, route := range routes {
+			if route.match(r) {
+				return r.Method + " " + route.name
+			}
+		}
+		return r.Method + " " + sanitizePath(r.URL.Path)
+	}
+}
+
+type routeTemplate struct {
+	method string
+	host   string
+	// name is the template without its method.
+	name     string
+	segments []string
+	// subtree is set for the templates with a trailing slash, which match every path under them.
+	subtree bool
+}
+
+func parseRouteTemplate(pattern string) routeTemplate {
+	var route routeTemplate
+	pattern = strings.TrimSpace(pattern)
+	if i := strings.IndexAny(pattern, " \t"); 0 <= i {
+		route.method, pattern = pattern[:i], strings.TrimSpace(pattern[i+1:])
+	}
+	route.name = pattern
+	if i := strings.Index(pattern, "/"); 0 < i {
+		route.host, pattern = pattern[:i], pattern[i:]
+	}
+	route.segments = strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	last := len(route.segments) - 1
+	switch route.segments[last] {
+	case "{$}":
+		route.segments[last] = ""
+	case "":
+		route.subtree = true
+	}
+	return route
+}
+
+func (route routeTemplate) match(r *http.Request) bool {
+	if route.method != "" && route.method != r.Method && !(route.method == http.MethodGet && r.Method == http.MethodHead) {
+		return false
+	}
+	if route.host != "" && route.host != requestHostname(r) {
+		return false
+	}
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	for i, want := range route.segments {
+		if len(segments) <= i {
+			return false
+		}
+		if i == len(route.segments)-1 && route.subtree {
+			return true
+		}
+		if strings.HasPrefix(want, "{") && strings.HasSuffix(want, "...}") {
+			return true
+		}
+		if strings.HasPrefix(want, "{") && strings.HasSuffix(want, "}") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segments[i] != want {
+			return false
+		}
+	}
+	return len(segments) == len(route.segments)
+}
+
+// requestHostname is the host of the request without its port,
+// taken from the URL of an outbound request, or the Host header of an inbound one.
+func requestHostname(r *http.Request) string {
+	if r.URL.Host != "" {
+		return r.URL.Hostname()
+	}
+	return hostname(r.Host)
+}
+
+// sanitizePath replaces the path segments that look like ids with "{id}",
+// to keep the cardinality of the span names low when no route pattern is known.
+func sanitizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if looksLikeID(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func looksLikeID(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	var digits, hex int
+	for _, c := range segment {
+		switch {
+		case '0' <= c && c <= '9':
+			digits++
+		case 'a' <= c && c <= 'f', 'A' <= c && c <= 'F', c == '-':
+			hex++
+		default:
+			return false
+		}
+	}
+	// numeric ids, or hex ids and UUIDs, which are long and contain digits
+	return digits == len(segment) || (16 <= len(segment) && 0 < digits)
+}
+
+const defaultServerSpanName = "http-server-request"
+
+func (mw HTTPMiddlewareTracing) propagator() propagation.TextMapPropagator {
+	if mw.Propagator != nil {
+		return mw.Propagator
+	}
+	return DefaultPropagator()
+}
+
+func (mw HTTPMiddlewareTracing) tracer() trace.Tracer {
+	if mw.Tracer != nil {
+		return mw.Tracer
+	}
+	return otel.GetTracerProvider().Tracer(instrumentationName, trace.WithInstrumentationVersion(Version))
+}
+
+// HTTPMiddlewareResponseStatus records the response status code of the Next handler
+// as the http.status_code attribute of the span in the request context,
+// or as http.response.status_code with SemconvV1_21.
+// When the Next handler doesn't write the header explicitly, the status code is 200.
+// The ResponseWriter passed to Next implements http.Flusher and http.Hijacker:
+// Flush is a no-op when the wrapped ResponseWriter can't flush, and Hijack returns an error when it can't hijack.
+// Once the connection is hijacked, no status code is recorded, since it's written by the Next handler directly.
+type HTTPMiddlewareResponseStatus struct {
+	Next    http.Handler
+	Semconv SemconvVersion
+}
+
+func (mw HTTPMiddlewareResponseStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &statusRecorder{ResponseWriter: w}
+	mw.Next.ServeHTTP(rec, r)
+	if rec.hijacked {
+		return
+	}
+	trace.SpanFromContext(r.Context()).SetAttributes(httpAttributes{version: mw.Semconv}.statusCode(rec.Status()))
+}
+
+// statusRecorder captures the status code written to the wrapped http.ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	// hijacked tells that the connection was taken over, so the status code, like a 101 upgrade, is unknown.
+	hijacked bool
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush passes through to the wrapped http.ResponseWriter when it supports flushing,
+// otherwise it's a no-op.
+func (rec *statusRecorder) Flush() {
+	f, ok := rec.ResponseWriter.(http.Flusher)
+	if !ok {
+		return
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	f.Flush()
+}
+
+// Hijack passes through to the wrapped http.ResponseWriter when it supports hijacking,
+// otherwise it returns an error.
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T doesn't implement http.Hijacker", rec.ResponseWriter)
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		rec.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap makes the wrapped http.ResponseWriter accessible for http.ResponseController.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Status returns the written status code, which is http.StatusOK when WriteHeader was never called.
+func (rec *statusRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+type HTTPRoundTripper struct {
+	Next http.RoundTripper
+	// Propagator is used to inject the tracing into the request headers.
+	// When it's nil, DefaultPropagator is used.
+	Propagator propagation.TextMapPropagator
+	Tracer     trace.Tracer
+	// TracerProvider is used to obtain the tracer when Tracer is nil.
+	// When both of them are nil, the global TracerProvider is used.
+	TracerProvider trace.TracerProvider
+	// InstrumentationName is the name of the tracer obtained from the TracerProvider.
+	// By default, it is the otelkit package's import path.
+	InstrumentationName string
+	// InstrumentationVersion is the version of the tracer obtained from the TracerProvider.
+	// By default, it is the otelkit Version, unless a custom InstrumentationName is provided.
+	InstrumentationVersion string
+	SpanNameFn             func(r *http.Request) string
+	// SpanNameWithDefaultFn names the span just like SpanNameFn, which takes precedence over it,
+	// but it also receives the default span name, so it can be extended, e.g. prefixed with the method.
+	SpanNameWithDefaultFn func(r *http.Request, defaultName string) string
+	// RecordResponseContentType will record the response's Content-Type header on the span.
+	RecordResponseContentType bool
+	// RecordResponseSize records the size of the response headers and the response body separately,
+	// as otelkit.http.response.header_bytes and otelkit.http.response.body_bytes,
+	// which tells header bloat, like huge cookies, apart from large payloads.
+	// The header size is the sum of the lengths of the header keys and values.
+	// The body size is only recorded when the response's content length is known.
+	RecordResponseSize bool
+	// RecordTLS records the negotiated TLS version and cipher suite of the response as tls.protocol.version and tls.cipher,
+	// which helps to find the outbound calls with weak TLS configurations.
+	// Responses received over plaintext connections have no such attributes.
+	RecordTLS bool
+	// RecordTimingEvents adds a span event when the request is dispatched,
+	// and another when the first byte of the response is available,
+	// which makes the time to first byte visible on the span.
+	RecordTimingEvents bool
+	// RecordTimingBreakdown splits the latency of the request into the otelkit.http.connect_ms attribute,
+	// which is the time spent on obtaining a connection, including dialing and TLS handshake,
+	// and the otelkit.http.ttfb_ms attribute, which is the time from dispatching the request until the first response byte.
+	// It helps to tell whether the latency is in the connection setup or in the processing of the downstream.
+	RecordTimingBreakdown bool
+	// RecordErrorAttribute sets the otelkit.error attribute to the error message when Next fails,
+	// since some backends display a dedicated error attribute more prominently than the span status.
+	RecordErrorAttribute bool
+	// RedactErrorFn formats the error for the otelkit.error attribute, the span status and the recorded exception event,
+	// which allows removing sensitive data from the message before it is recorded.
+	RedactErrorFn func(err error) string
+	// SpanContextFn receives the span context of the client span that is started for the outbound request.
+	// It allows the caller to observe the child span, e.g. to log its span id,
+	// which is otherwise only visible to the Next round tripper.
+	SpanContextFn func(r *http.Request, sc trace.SpanContext)
+	// SkipInject still records the client span, but won't inject the tracing into the outbound request headers.
+	// This is for setups where header injection is disallowed or done by a different hop.
+	SkipInject bool
+	// PropagateBaggage injects the baggage of the request context into the outbound request headers too,
+	// for propagators that only deal with the trace context, like the propagation.TraceContext.
+	// It's not needed when the propagator is a composite that already includes propagation.Baggage.
+	PropagateBaggage bool
+	// Filter decides whether the request is traced.
+	// When it returns false, no span is started, and no tracing is injected, the request is just passed to Next.
+	// It's meant for noisy requests, like health checks or metrics scrapes.
+	// When Filter is nil, all the requests are traced.
+	Filter func(r *http.Request) bool
+	// Timeout limits the duration of the request, including the reading of the response body.
+	// When the timeout imposed by HTTPRoundTripper is reached before the response headers arrive,
+	// it's recorded as an otelkit.timeout span event,
+	// making it distinguishable from the errors of the downstream and the deadline of the request context.
+	// The span ends when RoundTrip returns, so a timeout while reading the response body isn't recorded,
+	// it's only returned as the error of the body's Read.
+	Timeout time.Duration
+	// PeerServiceFn names the logical service that the request targets, which is recorded as peer.service.
+	// Service dependency graphs are drawn from it, so the default, which is the host of the request URL,
+	// should be replaced whenever the host doesn't tell the logical name of the downstream.
+	PeerServiceFn func(r *http.Request) string
+	// OperationFn names the logical operation of the request, which is recorded as otelkit.operation.
+	// Unlike the span name, it's meant to be a stable aggregation key, like "payments.create",
+	// so traces can be grouped by it even when the span names vary, e.g. by route.
+	OperationFn func(r *http.Request) string
+	// ContextAttributesFn returns attributes from values of the request context,
+	// like a tenant id placed there by an upstream HTTPMiddlewareWithContext,
+	// which are then recorded on the client span.
+	ContextAttributesFn func(ctx context.Context) []attribute.KeyValue
+	// AttributesFn returns custom attributes for the request, like a tenant id from a header,
+	// which are recorded on the client span in addition to the semantic convention attributes.
+	AttributesFn func(r *http.Request) []attribute.KeyValue
+	// RecordQueryParams lists the query parameters that are recorded as http.request.query.<name> attributes.
+	// Only the allowed parameters are recorded, as string slices, including all the values of a repeated parameter.
+	RecordQueryParams []string
+	// RecordBodyProgressBytes adds an otelkit.request.body.progress span event
+	// every time this many more bytes of the request body are read, when it's greater than zero.
+	// It makes the progress of slow or large uploads visible on the span.
+	RecordBodyProgressBytes int64
+	// RecordSecure sets the http.secure attribute to whether the request URL's scheme is https,
+	// so insecure outbound calls can be queried without comparing scheme strings.
+	RecordSecure bool
+	// AttributeLimit caps the number of attributes of the span, when it's greater than zero.
+	// It covers both the attributes the span is started with and the ones recorded after the round trip, like the status code.
+	// The attributes over the limit, e.g. the excess from ContextAttributesFn or AttributesFn, are dropped,
+	// and the otelkit.attributes_truncated attribute is set to signal that the span is incomplete.
+	AttributeLimit int
+	// LinksFn returns links for the client span, e.g. to the span of the batch that the request fans out from,
+	// so the outbound span can be related to other traces than the one of its parent.
+	LinksFn func(r *http.Request) []trace.Link
+	// Semconv selects the semantic conventions of the recorded HTTP attributes.
+	// By default, it's SemconvV1_7.
+	Semconv SemconvVersion
+	// SpanKind overrides the kind of the started span, e.g. with trace.SpanKindInternal in a proxy.
+	// By default, it's trace.SpanKindClient.
+	SpanKind trace.SpanKind
 }
 
 const defaultSpanName = "http-request"
 
+const errorKey = attribute.Key("otelkit.error")
+
+const operationKey = attribute.Key("otelkit.operation")
+
+const attributesTruncatedKey = attribute.Key("otelkit.attributes_truncated")
+
+func limitAttributes(attrs []attribute.KeyValue, limit int) []attribute.KeyValue {
+	if limit <= 0 || len(attrs) <= limit {
+		return attrs
+	}
+	return append(attrs[:limit:limit], attributesTruncatedKey.Bool(true))
+}
+
+// limitSpanAttributes makes the attributes set on the span after its start count towards the limit too,
+// given the number of the attributes that the span was started with, before limitAttributes.
+func limitSpanAttributes(span trace.Span, limit, startAttributes int) trace.Span {
+	if limit <= 0 {
+		return span
+	}
+	ls := &attributeLimitedSpan{Span: span, limit: limit, count: startAttributes}
+	if limit < startAttributes {
+		ls.count, ls.truncated = limit, true
+	}
+	return ls
+}
+
+// attributeLimitedSpan drops the attributes over the limit, and marks the span as truncated once.
+// It's safe for concurrent use, as the attributes may be set from httptrace callbacks.
+type attributeLimitedSpan struct {
+	trace.Span
+	limit int
+
+	m         sync.Mutex
+	count     int
+	truncated bool
+}
+
+func (s *attributeLimitedSpan) SetAttributes(kvs ...attribute.KeyValue) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if free := s.limit - s.count; len(kvs) <= free {
+		s.count += len(kvs)
+		s.Span.SetAttributes(kvs...)
+		return
+	} else if 0 < free {
+		s.count = s.limit
+		s.Span.SetAttributes(kvs[:free]...)
+	}
+	if !s.truncated {
+		s.truncated = true
+		s.Span.SetAttributes(attributesTruncatedKey.Bool(true))
+	}
+}
+
+const (
+	timeoutEventName = "otelkit.timeout"
+	timeoutMSKey     = attribute.Key("otelkit.timeout_ms")
+)
+
+const (
+	requestDispatchedEventName = "otelkit.http.request.dispatched"
+	responseFirstByteEventName = "otelkit.http.response.first_byte"
+)
+
+const (
+	connectMSKey = attribute.Key("otelkit.http.connect_ms")
+	ttfbMSKey    = attribute.Key("otelkit.http.ttfb_ms")
+)
+
+func newTimingBreakdown(span trace.Span) *timingBreakdown {
+	return &timingBreakdown{span: span}
+}
+
+// timingBreakdown measures the phases of a request with httptrace.
+// The httptrace hooks are called from the goroutines of the transport, thus the mutex.
+type timingBreakdown struct {
+	span trace.Span
+
+	m          sync.Mutex
+	getConn    time.Time
+	dispatched time.Time
+}
+
+func (b *timingBreakdown) ClientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			b.m.Lock()
+			defer b.m.Unlock()
+			b.getConn = time.Now()
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			b.m.Lock()
+			defer b.m.Unlock()
+			if b.getConn.IsZero() {
+				return
+			}
+			b.span.SetAttributes(connectMSKey.Float64(durationInMilliseconds(time.Since(b.getConn))))
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			b.m.Lock()
+			defer b.m.Unlock()
+			b.dispatched = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			b.m.Lock()
+			defer b.m.Unlock()
+			if b.dispatched.IsZero() {
+				return
+			}
+			b.span.SetAttributes(ttfbMSKey.Float64(durationInMilliseconds(time.Since(b.dispatched))))
+		},
+	}
+}
+
+const httpResponseContentTypeKey = attribute.Key("http.response.header.content_type")
+
+const httpSecureKey = attribute.Key("http.secure")
+
+const (
+	tlsProtocolVersionKey = attribute.Key("tls.protocol.version")
+	tlsCipherKey          = attribute.Key("tls.cipher")
+)
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	default:
+		return fmt.Sprintf("0x%04X", version)
+	}
+}
+
+const queryParamKeyPrefix = "http.request.query."
+
+// knownContentLength tells whether the client request's ContentLength is its actual length.
+// Besides -1, a zero ContentLength with a body other than http.NoBody also means that the length is unknown.
+func knownContentLength(request *http.Request) bool {
+	if request.ContentLength < 0 {
+		return false
+	}
+	return request.ContentLength != 0 || request.Body == nil || request.Body == http.NoBody
+}
+
+// withoutQuery returns a shallow copy of the request without the query when query parameters are allowlisted,
+// so the attributes made from the request URL, like http.target and http.url,
+// don't leak the parameters that are not on the allowlist.
+func withoutQuery(r *http.Request, allowlist []string) *http.Request {
+	if len(allowlist) == 0 {
+		return r
+	}
+	u := *r.URL
+	u.RawQuery = ""
+	u.ForceQuery = false
+	out := r.WithContext(r.Context())
+	out.URL = &u
+	if i := strings.IndexByte(out.RequestURI, '?'); 0 <= i {
+		out.RequestURI = out.RequestURI[:i]
+	}
+	return out
+}
+
+func queryParamAttributes(u *url.URL, names []string) []attribute.KeyValue {
+	if len(names) == 0 {
+		return nil
+	}
+	query := u.Query()
+	var attrs []attribute.KeyValue
+	for _, name := range names {
+		values, ok := query[name]
+		if !ok {
+			continue
+		}
+		attrs = append(attrs, attribute.Key(queryParamKeyPrefix+name).StringSlice(values))
+	}
+	return attrs
+}
+
 func (r HTTPRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	if r.Filter != nil && !r.Filter(request) {
+		return r.Next.RoundTrip(request)
+	}
+	httpAttrs := httpAttributes{version: r.Semconv}
+	attrs := httpAttrs.request(withoutQuery(request, r.RecordQueryParams))
+	if knownContentLength(request) {
+		attrs = append(attrs, httpAttrs.requestContentLength(request.ContentLength))
+	}
+	if peerService := r.peerService(request); peerService != "" {
+		attrs = append(attrs, semconv.PeerServiceKey.String(peerService))
+	}
+	if r.OperationFn != nil {
+		if operation := r.OperationFn(request); operation != "" {
+			attrs = append(attrs, operationKey.String(operation))
+		}
+	}
+	attrs = append(attrs, queryParamAttributes(request.URL, r.RecordQueryParams)...)
+	if r.RecordSecure {
+		attrs = append(attrs, httpSecureKey.Bool(request.URL.Scheme == "https"))
+	}
+	if r.ContextAttributesFn != nil {
+		attrs = append(attrs, r.ContextAttributesFn(request.Context())...)
+	}
+	if r.AttributesFn != nil {
+		attrs = append(attrs, r.AttributesFn(request)...)
+	}
 	spanStartOptions := []trace.SpanStartOption{
-		trace.WithAttributes(
-			semconv.HTTPMethodKey.String(request.Method),
-			semconv.HTTPURLKey.String(request.URL.String()),
-			semconv.HTTPSchemeKey.String(request.URL.Scheme),
-			semconv.HTTPHostKey.String(request.Host)),
-		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(limitAttributes(attrs, r.AttributeLimit)...),
+		trace.WithSpanKind(r.spanKind()),
+	}
+	if r.LinksFn != nil {
+		spanStartOptions = append(spanStartOptions, trace.WithLinks(r.LinksFn(request)...))
 	}
 
 	spanName := defaultSpanName
 	if r.SpanNameFn != nil {
 		spanName = r.SpanNameFn(request)
+	} else if r.SpanNameWithDefaultFn != nil {
+		spanName = r.SpanNameWithDefaultFn(request, defaultSpanName)
 	}
 
-	ctx, span := r.Tracer.Start(request.Context(), spanName, spanStartOptions...)
+	ctx, span := r.tracer().Start(request.Context(), spanName, spanStartOptions...)
+	span = limitSpanAttributes(span, r.AttributeLimit, len(attrs))
 	defer span.End()
+	if r.SpanContextFn != nil {
+		r.SpanContextFn(request, span.SpanContext())
+	}
+
+	if r.RecordTimingEvents {
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			WroteRequest:         func(httptrace.WroteRequestInfo) { span.AddEvent(requestDispatchedEventName) },
+			GotFirstResponseByte: func() { span.AddEvent(responseFirstByteEventName) },
+		})
+	}
+	if r.RecordTimingBreakdown {
+		ctx = httptrace.WithClientTrace(ctx, newTimingBreakdown(span).ClientTrace())
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+
+	if !r.SkipInject {
+		r.propagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+	}
+	response, err := r.Next.RoundTrip(r.withBodyProgress(request.WithContext(ctx), span))
+	if err != nil {
+		r.recordTimeout(span, request.Context(), ctx)
+		cancel()
+		r.recordError(span, err)
+		return response, err
+	}
+	if response == nil {
+		cancel()
+		return response, err
+	}
+	if r.Timeout > 0 {
+		response.Body = cancelOnCloseBody(response.Body, cancel)
+	}
+	recordResponseStatus(span, httpAttrs, response.StatusCode)
+	if 0 <= response.ContentLength {
+		span.SetAttributes(httpAttrs.responseContentLength(response.ContentLength))
+	}
+	if contentType := response.Header.Get("Content-Type"); r.RecordResponseContentType && contentType != "" {
+		span.SetAttributes(httpResponseContentTypeKey.String(contentType))
+	}
+	if r.RecordResponseSize {
+		recordResponseSize(span, response)
+	}
+	if r.RecordTLS && response.TLS != nil {
+		span.SetAttributes(
+			tlsProtocolVersionKey.String(tlsVersionName(response.TLS.Version)),
+			tlsCipherKey.String(tls.CipherSuiteName(response.TLS.CipherSuite)))
+	}
+	return response, err
+}
+
+const (
+	responseHeaderBytesKey = attribute.Key("otelkit.http.response.header_bytes")
+	responseBodyBytesKey   = attribute.Key("otelkit.http.response.body_bytes")
+)
+
+func recordResponseSize(span trace.Span, response *http.Response) {
+	var headerBytes int
+	for key, values := range response.Header {
+		for _, value := range values {
+			headerBytes += len(key) + len(value)
+		}
+	}
+	span.SetAttributes(responseHeaderBytesKey.Int(headerBytes))
+	if 0 <= response.ContentLength {
+		span.SetAttributes(responseBodyBytesKey.Int64(response.ContentLength))
+	}
+}
+
+// recordResponseStatus records the status code of the response,
+// and marks the span as failed on server errors.
+// Client errors are left unset, as they are not failures of the downstream.
+func recordResponseStatus(span trace.Span, httpAttrs httpAttributes, code int) {
+	span.SetAttributes(httpAttrs.statusCode(code))
+	if code >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d %s", code, http.StatusText(code)))
+	}
+}
+
+func (r HTTPRoundTripper) spanKind() trace.SpanKind {
+	if r.SpanKind != trace.SpanKindUnspecified {
+		return r.SpanKind
+	}
+	return trace.SpanKindClient
+}
+
+func (r HTTPRoundTripper) propagator() propagation.TextMapPropagator {
+	propagator := r.Propagator
+	if propagator == nil {
+		propagator = DefaultPropagator()
+	}
+	if r.PropagateBaggage {
+		return propagation.NewCompositeTextMapPropagator(propagator, propagation.Baggage{})
+	}
+	return propagator
+}
+
+func (r HTTPRoundTripper) peerService(request *http.Request) string {
+	if r.PeerServiceFn != nil {
+		return r.PeerServiceFn(request)
+	}
+	return request.URL.Hostname()
+}
+
+func (r HTTPRoundTripper) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.Timeout)
+}
+
+// recordTimeout records the timeout event when the deadline imposed by the Timeout is exceeded,
+// and not the one that the original request context had.
+func (r HTTPRoundTripper) recordTimeout(span trace.Span, requestCtx, ctx context.Context) {
+	if r.Timeout <= 0 || requestCtx.Err() != nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return
+	}
+	span.AddEvent(timeoutEventName, trace.WithAttributes(timeoutMSKey.Int64(r.Timeout.Milliseconds())))
+}
+
+// cancelOnCloseBody makes sure that the request context is released only after the response body is consumed.
+func cancelOnCloseBody(body io.ReadCloser, cancel context.CancelFunc) io.ReadCloser {
+	if body == nil {
+		cancel()
+		return body
+	}
+	return bodyCloser{ReadCloser: body, cancel: cancel}
+}
+
+type bodyCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b bodyCloser) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+const (
+	bodyProgressEventName = "otelkit.request.body.progress"
+	bodyBytesReadKey      = attribute.Key("otelkit.request.body.bytes_read")
+)
+
+// withBodyProgress wraps the body of the outbound request.
+// The outbound request is a shallow copy, so the caller's request and its ContentLength are left intact.
+func (r HTTPRoundTripper) withBodyProgress(outbound *http.Request, span trace.Span) *http.Request {
+	if r.RecordBodyProgressBytes <= 0 || outbound.Body == nil || outbound.Body == http.NoBody {
+		return outbound
+	}
+	outbound.Body = &progressBody{
+		ReadCloser: outbound.Body,
+		span:       span,
+		step:       r.RecordBodyProgressBytes,
+		next:       r.RecordBodyProgressBytes,
+	}
+	return outbound
+}
+
+type progressBody struct {
+	io.ReadCloser
+	span trace.Span
+	step int64
+	next int64
+	read int64
+}
+
+func (b *progressBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	for b.next <= b.read {
+		b.span.AddEvent(bodyProgressEventName, trace.WithAttributes(bodyBytesReadKey.Int64(b.next)))
+		b.next += b.step
+	}
+	return n, err
+}
+
+// recordError marks the span as failed due to the error of the transport, like a DNS failure or a refused connection.
+func (r HTTPRoundTripper) recordError(span trace.Span, err error) {
+	msg := err.Error()
+	if r.RedactErrorFn != nil {
+		msg = r.RedactErrorFn(err)
+		err = errors.New(msg)
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, msg)
+	if r.RecordErrorAttribute {
+		span.SetAttributes(errorKey.String(msg))
+	}
+}
+
+func (r HTTPRoundTripper) tracer() trace.Tracer {
+	if r.Tracer != nil {
+		return r.Tracer
+	}
+	tp := r.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	name, version := r.InstrumentationName, r.InstrumentationVersion
+	if name == "" {
+		name = instrumentationName
+		if version == "" {
+			version = Version
+		}
+	}
+	return tp.Tracer(name, trace.WithInstrumentationVersion(version))
+}
+
+// RoundTripperOption configures the HTTPRoundTripper made by NewHTTPRoundTripper.
+type RoundTripperOption func(r *HTTPRoundTripper)
+
+// NewHTTPRoundTripper makes an HTTPRoundTripper that wraps next, configured with the options.
+// When next is nil, http.DefaultTransport is used.
+// The fields not covered by an option can still be set on the returned value.
+func NewHTTPRoundTripper(next http.RoundTripper, opts ...RoundTripperOption) HTTPRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	r := HTTPRoundTripper{Next: next}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return r
+}
+
+// WithTracer sets the HTTPRoundTripper's Tracer.
+func WithTracer(tracer trace.Tracer) RoundTripperOption {
+	return func(r *HTTPRoundTripper) { r.Tracer = tracer }
+}
+
+// WithPropagator sets the HTTPRoundTripper's Propagator.
+func WithPropagator(propagator propagation.TextMapPropagator) RoundTripperOption {
+	return func(r *HTTPRoundTripper) { r.Propagator = propagator }
+}
+
+// WithSpanNameFn sets the HTTPRoundTripper's SpanNameFn.
+func WithSpanNameFn(fn func(r *http.Request) string) RoundTripperOption {
+	return func(r *HTTPRoundTripper) { r.SpanNameFn = fn }
+}
 
-	r.Propagator.Inject(ctx, propagation.HeaderCarrier(request.Header))
-	return r.Next.RoundTrip(request.WithContext(ctx))
+// WithFilter sets the HTTPRoundTripper's Filter.
+func WithFilter(filter func(r *http.Request) bool) RoundTripperOption {
+	return func(r *HTTPRoundTripper) { r.Filter = filter }
 }
 
+// ContextWithBaggage sets the members on the baggage of the context.
+// Members are applied in argument order, and when two members share the same key,
+// the later one replaces the earlier one together with its properties.
 func ContextWithBaggage[Member baggage.Member | func() (baggage.Member, error)](
 	ctx context.Context, CorrelationContextData ...Member) (context.Context, error) {
 
@@ -2,21 +2,29 @@ package otelkit_test
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"github.com/adamluzsi/otelkit"
 	"github.com/adamluzsi/testcase"
 	"github.com/adamluzsi/testcase/assert"
 	"github.com/adamluzsi/testcase/random"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
 	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"go.opentelemetry.io/otel/trace"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestWithContextMiddleware_ServeHTTP(t *testing.T) {
@@ -96,6 +104,158 @@ func TestWithContextMiddleware_ServeHTTP(t *testing.T) {
 	})
 }
 
+func TestWithContextMiddleware_WithContextErrFn(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	type ctxKey struct{}
+	var (
+		fnErr      = testcase.LetValue[error](s, nil)
+		statusCode = testcase.LetValue(s, 0)
+		span       = testcase.Let(s, func(t *testcase.T) trace.Span {
+			ctx, span := tracer.Get(t).Start(request.Get(t).Context(), exampleSpanName.Get(t))
+			request.Set(t, request.Get(t).WithContext(ctx))
+			return span
+		})
+	)
+	makeSubject := func(t *testcase.T, next http.Handler) http.Handler {
+		return otelkit.HTTPMiddlewareWithContext{
+			Next: next,
+			WithContextErrFn: func(ctx context.Context, sc trace.SpanContext) (context.Context, error) {
+				if err := fnErr.Get(t); err != nil {
+					return ctx, err
+				}
+				return context.WithValue(ctx, ctxKey{}, sc.TraceID()), nil
+			},
+			ErrorStatusCode: statusCode.Get(t),
+		}
+	}
+	act := func(t *testcase.T) {
+		span.Get(t)
+		makeSubject(t, stubHandler.Get(t)).ServeHTTP(responseRecorder.Get(t), request.Get(t))
+	}
+
+	ItBehavesLikeAMiddleware(s, makeSubject)
+
+	s.Then("the derived context is forwarded to the next handler", func(t *testcase.T) {
+		act(t)
+
+		lastReceivedRequest := getLastReceivedRequest(t, stubHandler.Get(t).Requests)
+		t.Must.Equal(any(span.Get(t).SpanContext().TraceID()), lastReceivedRequest.Context().Value(ctxKey{}))
+	})
+
+	s.When("the function returns an error", func(s *testcase.Spec) {
+		fnErr.Let(s, func(t *testcase.T) error {
+			return errors.New(t.Random.StringNC(8, random.CharsetAlpha()))
+		})
+
+		s.Then("the next handler is not called", func(t *testcase.T) {
+			act(t)
+
+			t.Must.Empty(stubHandler.Get(t).Requests)
+		})
+
+		s.Then("internal server error is returned by default", func(t *testcase.T) {
+			act(t)
+
+			t.Must.Equal(http.StatusInternalServerError, responseRecorder.Get(t).Code)
+		})
+
+		s.Then("the error is recorded on the span", func(t *testcase.T) {
+			act(t)
+			span.Get(t).End()
+
+			spans := stubSpanExporter.Get(t).ExportedSpans()
+			t.Must.Equal(1, len(spans))
+			t.Must.Equal(codes.Error, spans[0].Status().Code)
+			otelkit.AssertRecordedError(t, spans[0], fnErr.Get(t).Error())
+		})
+
+		s.And("error status code is configured", func(s *testcase.Spec) {
+			statusCode.LetValue(s, http.StatusBadRequest)
+
+			s.Then("the configured status code is returned", func(t *testcase.T) {
+				act(t)
+
+				t.Must.Equal(http.StatusBadRequest, responseRecorder.Get(t).Code)
+			})
+		})
+	})
+}
+
+func TestWithContextMiddleware_remoteSpanContext(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	skipRemote := testcase.LetValue(s, false)
+	received := testcase.LetValue[[]trace.SpanContext](s, nil)
+	act := func(t *testcase.T, ctx context.Context) {
+		otelkit.HTTPMiddlewareWithContext{
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+			WithContextFn: func(ctx context.Context, sc trace.SpanContext) context.Context {
+				received.Set(t, append(received.Get(t), sc))
+				return ctx
+			},
+			SkipRemote: skipRemote.Get(t),
+		}.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	}
+	remoteOnlyContext := func(t *testcase.T) context.Context {
+		_, sc := MakeTestSpanContext(nil)
+		return trace.ContextWithRemoteSpanContext(context.Background(), sc)
+	}
+	localContext := func(t *testcase.T) context.Context {
+		ctx, _ := MakeTestSpanContext(remoteOnlyContext(t))
+		return ctx
+	}
+
+	s.Then("remote only span context is passed to the function, reporting that it is remote", func(t *testcase.T) {
+		act(t, remoteOnlyContext(t))
+
+		t.Must.Equal(1, len(received.Get(t)))
+		t.Must.True(received.Get(t)[0].IsRemote())
+	})
+
+	s.Then("locally started span's context is passed to the function as not remote", func(t *testcase.T) {
+		act(t, localContext(t))
+
+		t.Must.Equal(1, len(received.Get(t)))
+		t.Must.False(received.Get(t)[0].IsRemote())
+	})
+
+	s.Then("locally started root span's context is passed to the function, even without inbound tracing headers", func(t *testcase.T) {
+		ctx, sc := MakeTestSpanContext(nil)
+		act(t, ctx)
+
+		t.Must.Equal(1, len(received.Get(t)))
+		t.Must.Equal(sc, received.Get(t)[0])
+		t.Must.False(received.Get(t)[0].IsRemote())
+	})
+
+	s.When("remote span contexts are skipped", func(s *testcase.Spec) {
+		skipRemote.LetValue(s, true)
+
+		s.Then("the function is still called with the context of a locally started root span", func(t *testcase.T) {
+			ctx, _ := MakeTestSpanContext(nil)
+			act(t, ctx)
+
+			t.Must.Equal(1, len(received.Get(t)))
+		})
+
+		s.Then("the function is not called with a remote only span context", func(t *testcase.T) {
+			act(t, remoteOnlyContext(t))
+
+			t.Must.Empty(received.Get(t))
+		})
+
+		s.Then("the function is still called with the context of a locally started span", func(t *testcase.T) {
+			act(t, localContext(t))
+
+			t.Must.Equal(1, len(received.Get(t)))
+			t.Must.False(received.Get(t)[0].IsRemote())
+		})
+	})
+}
+
 func TestNoTracingWarningMiddleware_ServeHTTP(t *testing.T) {
 	s := testcase.NewSpec(t)
 	s.NoSideEffect()
@@ -151,6 +311,7 @@ func TestNoTracingWarningMiddleware_ServeHTTP(t *testing.T) {
 				event := events[0]
 				t.Must.Contain(event.MissingHeaders, "traceparent",
 					"TraceContext propagator should look for the missing traceparent header")
+				t.Must.Equal(otelkit.NoTracingReasonMissingHeaders, event.Reason)
 				t.Must.NotEmpty(event.Request)
 				t.Must.Equal(request.Get(t).Context(), event.Request.Context())
 				t.Must.Equal(request.Get(t).Method, event.Request.Method)
@@ -179,6 +340,37 @@ func TestNoTracingWarningMiddleware_ServeHTTP(t *testing.T) {
 			})
 		})
 
+		s.And("the received request has a traceparent with all zero trace id", func(s *testcase.Spec) {
+			s.Before(func(t *testcase.T) {
+				_, sc := MakeTestSpanContext(nil)
+				request.Get(t).Header.Set(traceParentHeaderKey, "00-00000000000000000000000000000000-"+sc.SpanID().String()+"-01")
+			})
+
+			ItBehavesLikeAMiddleware(s, makeSubject)
+
+			s.Then("it warns with the zero trace id reason", func(t *testcase.T) {
+				act(t)
+
+				t.Must.Equal(1, len(loggedEvents.Get(t)))
+				event := loggedEvents.Get(t)[0]
+				t.Must.Equal(otelkit.NoTracingReasonZeroTraceID, event.Reason)
+				t.Must.Empty(event.MissingHeaders)
+			})
+		})
+
+		s.And("the received request has a malformed traceparent", func(s *testcase.Spec) {
+			s.Before(func(t *testcase.T) {
+				request.Get(t).Header.Set(traceParentHeaderKey, t.Random.StringNC(16, random.CharsetAlpha()))
+			})
+
+			s.Then("it warns with the invalid span context reason", func(t *testcase.T) {
+				act(t)
+
+				t.Must.Equal(1, len(loggedEvents.Get(t)))
+				t.Must.Equal(otelkit.NoTracingReasonInvalid, loggedEvents.Get(t)[0].Reason)
+			})
+		})
+
 		s.And("the received request has trace", func(s *testcase.Spec) {
 			GivenRequestHeaderHasTracing(s)
 
@@ -193,6 +385,264 @@ func TestNoTracingWarningMiddleware_ServeHTTP(t *testing.T) {
 	})
 }
 
+func TestHTTPMiddlewareRequireTracing_ServeHTTP(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	var (
+		statusCode  = testcase.LetValue(s, 0)
+		body        = testcase.LetValue[[]byte](s, nil)
+		exemptPaths = testcase.LetValue[[]string](s, nil)
+	)
+	makeSubject := func(t *testcase.T, next http.Handler) http.Handler {
+		return otelkit.HTTPMiddlewareRequireTracing{
+			Next:        next,
+			Propagator:  propagator.Get(t),
+			StatusCode:  statusCode.Get(t),
+			Body:        body.Get(t),
+			ExemptPaths: exemptPaths.Get(t),
+		}
+	}
+	act := func(t *testcase.T) {
+		makeSubject(t, stubHandler.Get(t)).ServeHTTP(responseRecorder.Get(t), request.Get(t))
+	}
+
+	s.When("the request has tracing", func(s *testcase.Spec) {
+		GivenRequestHeaderHasTracing(s)
+
+		ItBehavesLikeAMiddleware(s, makeSubject)
+	})
+
+	s.When("the request doesn't have tracing", func(s *testcase.Spec) {
+		s.Then("it is rejected with bad request", func(t *testcase.T) {
+			act(t)
+
+			t.Must.Empty(stubHandler.Get(t).Requests)
+			t.Must.Equal(http.StatusBadRequest, responseRecorder.Get(t).Code)
+			t.Must.Empty(responseRecorder.Get(t).Body.String())
+		})
+
+		s.And("status code and body are configured", func(s *testcase.Spec) {
+			statusCode.LetValue(s, http.StatusPreconditionRequired)
+			body.Let(s, func(t *testcase.T) []byte { return []byte("tracing is required") })
+
+			s.Then("they are used for the rejection", func(t *testcase.T) {
+				act(t)
+
+				t.Must.Empty(stubHandler.Get(t).Requests)
+				t.Must.Equal(http.StatusPreconditionRequired, responseRecorder.Get(t).Code)
+				t.Must.Equal("tracing is required", responseRecorder.Get(t).Body.String())
+			})
+		})
+
+		s.And("the path is exempt", func(s *testcase.Spec) {
+			exemptPaths.Let(s, func(t *testcase.T) []string {
+				return []string{"/healthz", request.Get(t).URL.Path}
+			})
+
+			ItBehavesLikeAMiddleware(s, makeSubject)
+		})
+	})
+
+	s.When("the request has malformed tracing", func(s *testcase.Spec) {
+		request.Let(s, func(t *testcase.T) *http.Request {
+			return otelkit.MakeMalformedTracingRequest(http.MethodGet, "/", nil)
+		})
+
+		s.Then("it is rejected", func(t *testcase.T) {
+			act(t)
+
+			t.Must.Empty(stubHandler.Get(t).Requests)
+			t.Must.Equal(http.StatusBadRequest, responseRecorder.Get(t).Code)
+		})
+	})
+}
+
+func TestNoTracingWarningMiddleware_customPropagatorHeaderCasing(t *testing.T) {
+	var events []otelkit.NoTracingWarningEvent
+	mw := otelkit.HTTPMiddlewareNoTracingWarning{
+		Next:       http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		Propagator: CustomHeaderPropagator{},
+		NotifyFn:   func(event otelkit.NoTracingWarningEvent) { events = append(events, event) },
+	}
+
+	t.Run("missing header is reported once in lower case", func(t *testing.T) {
+		events = nil
+		mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, []string{"x-custom-trace-id"}, events[0].MissingHeaders)
+	})
+
+	t.Run("header injected with a different casing is found", func(t *testing.T) {
+		events = nil
+		ctx, _ := MakeTestSpanContext(nil)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		CustomHeaderPropagator{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+		mw.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Empty(t, events)
+	})
+}
+
+func TestNoTracingWarningMiddleware_RequiredHeaders(t *testing.T) {
+	var events []otelkit.NoTracingWarningEvent
+	mw := otelkit.HTTPMiddlewareNoTracingWarning{
+		Next:            http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		Propagator:      propagation.TraceContext{},
+		NotifyFn:        func(event otelkit.NoTracingWarningEvent) { events = append(events, event) },
+		RequiredHeaders: []string{"B3", "X-Request-Id"},
+	}
+	tracedRequest := func() *http.Request {
+		ctx, _ := MakeTestSpanContext(nil)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+		return req
+	}
+
+	t.Run("missing required headers are merged with the ones the propagator looked up", func(t *testing.T) {
+		events = nil
+		mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, otelkit.NoTracingReasonMissingHeaders, events[0].Reason)
+		otelkit.AssertMissingHeaders(t, events[0], "traceparent", "b3", "x-request-id")
+	})
+
+	t.Run("missing required header is reported even when the propagator found the tracing", func(t *testing.T) {
+		events = nil
+		req := tracedRequest()
+		req.Header.Set("X-Request-Id", "42")
+		mw.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, otelkit.NoTracingReasonMissingHeaders, events[0].Reason)
+		otelkit.AssertMissingHeaders(t, events[0], "b3")
+	})
+
+	t.Run("no warning when the tracing and all the required headers are present", func(t *testing.T) {
+		events = nil
+		req := tracedRequest()
+		req.Header.Set("B3", "1")
+		req.Header.Set("X-Request-Id", "42")
+		mw.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Empty(t, events)
+	})
+}
+
+func TestNoTracingWarningMiddleware_SampleRate(t *testing.T) {
+	const requests = 1000
+	var (
+		mutex     sync.Mutex
+		notified  int
+		forwarded int
+	)
+	mw := otelkit.HTTPMiddlewareNoTracingWarning{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			forwarded++
+		}),
+		Propagator: propagation.TraceContext{},
+		NotifyFn: func(event otelkit.NoTracingWarningEvent) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			notified++
+		},
+		SampleRate: 0.5,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, requests, forwarded, "every request should be forwarded to the next handler")
+	assert.True(t, requests*3/10 < notified && notified < requests*7/10,
+		"about half of the requests should be notified, but got", notified)
+}
+
+func TestNoTracingWarningMiddleware_Propagators(t *testing.T) {
+	var events []otelkit.NoTracingWarningEvent
+	notifyFn := func(event otelkit.NoTracingWarningEvent) { events = append(events, event) }
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	middlewares := map[string]otelkit.HTTPMiddlewareNoTracingWarning{
+		"multiple propagators": {
+			Next:        next,
+			Propagator:  CustomHeaderPropagator{}, // ignored in favour of Propagators
+			Propagators: []propagation.TextMapPropagator{propagation.TraceContext{}, CustomHeaderPropagator{}},
+			NotifyFn:    notifyFn,
+		},
+		"composite propagator": {
+			Next:       next,
+			Propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, CustomHeaderPropagator{}),
+			NotifyFn:   notifyFn,
+		},
+	}
+	for name, mw := range middlewares {
+		mw := mw
+		t.Run(name, func(t *testing.T) {
+			t.Run("no warning when any of the propagators finds the tracing", func(t *testing.T) {
+				for _, p := range []propagation.TextMapPropagator{propagation.TraceContext{}, CustomHeaderPropagator{}} {
+					events = nil
+					ctx, _ := MakeTestSpanContext(nil)
+					req := httptest.NewRequest(http.MethodGet, "/", nil)
+					p.Inject(ctx, propagation.HeaderCarrier(req.Header))
+					mw.ServeHTTP(httptest.NewRecorder(), req)
+					assert.Empty(t, events)
+				}
+			})
+
+			t.Run("missing headers are the union of the ones the propagators looked up", func(t *testing.T) {
+				events = nil
+				mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+				assert.Equal(t, 1, len(events))
+				assert.Contain(t, events[0].MissingHeaders, "traceparent")
+				assert.Contain(t, events[0].MissingHeaders, "x-custom-trace-id")
+			})
+		})
+	}
+}
+
+// CustomHeaderPropagator uses non-canonical header names,
+// and a different casing for injection and extraction.
+type CustomHeaderPropagator struct{}
+
+func (CustomHeaderPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	carrier.Set("X-CUSTOM-TRACE-ID", sc.TraceID().String())
+	carrier.Set("X-CUSTOM-SPAN-ID", sc.SpanID().String())
+}
+
+func (CustomHeaderPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	value := carrier.Get("x-custom-trace-id")
+	if value == "" {
+		// looked up again on purpose, with yet another casing
+		value = carrier.Get("X-Custom-Trace-Id")
+	}
+	traceID, err := trace.TraceIDFromHex(value)
+	if err != nil {
+		return ctx
+	}
+	spanID, err := trace.SpanIDFromHex(carrier.Get("x-custom-span-id"))
+	if err != nil {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Remote:  true,
+	}))
+}
+
+func (CustomHeaderPropagator) Fields() []string {
+	return []string{"x-custom-trace-id", "x-custom-span-id"}
+}
+
 func GivenRequestHeaderHasTracing(s *testcase.Spec) {
 	spanContextConfig.Bind(s)
 	s.Before(func(t *testcase.T) {
@@ -343,13 +793,27 @@ func TestHTTPRoundTripper(t *testing.T) {
 		return &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK + t.Random.IntN(10)}}
 	})
 	spanNameFn := testcase.Var[func(*http.Request) string]{ID: "span name function"}
+	var (
+		attributesFn        = testcase.LetValue[func(*http.Request) []attribute.KeyValue](s, nil)
+		contextAttributesFn = testcase.LetValue[func(context.Context) []attribute.KeyValue](s, nil)
+		attributeLimit      = testcase.LetValue(s, 0)
+		recordQueryParams   = testcase.LetValue[[]string](s, nil)
+		recordResponseSize  = testcase.LetValue(s, false)
+		redactErrorFn       = testcase.LetValue[func(error) string](s, nil)
+	)
 
 	makeSubject := func(t *testcase.T, next http.RoundTripper) http.RoundTripper {
 		return otelkit.HTTPRoundTripper{
-			Next:       next,
-			Propagator: propagator.Get(t),
-			Tracer:     tracer.Get(t),
-			SpanNameFn: spanNameFn.Get(t),
+			Next:                next,
+			Propagator:          propagator.Get(t),
+			Tracer:              tracer.Get(t),
+			SpanNameFn:          spanNameFn.Get(t),
+			AttributesFn:        attributesFn.Get(t),
+			ContextAttributesFn: contextAttributesFn.Get(t),
+			AttributeLimit:      attributeLimit.Get(t),
+			RecordQueryParams:   recordQueryParams.Get(t),
+			RecordResponseSize:  recordResponseSize.Get(t),
+			RedactErrorFn:       redactErrorFn.Get(t),
 		}
 	}
 	subject := func(t *testcase.T) otelkit.HTTPRoundTripper {
@@ -380,80 +844,453 @@ func TestHTTPRoundTripper(t *testing.T) {
 		})
 
 		ThenItExportsTheRequestAttributes(s, act)
-	})
 
-	s.When("span function is provided", func(s *testcase.Spec) {
-		s.Before(func(t *testcase.T) {
-			t.Skip()
+		s.Then("the request and response content lengths are recorded", func(t *testcase.T) {
+			nextRoundTripper.Get(t).Response.ContentLength = 42
+			onSuccess(t)
+
+			exportedSpans := stubSpanExporter.Get(t).ExportedSpans()
+			t.Must.Equal(1, len(exportedSpans))
+			requestContentLength, ok := spanAttribute(exportedSpans[0], semconv.HTTPRequestContentLengthKey)
+			t.Must.True(ok)
+			t.Must.Equal(int64(len(requestBodyContent.Get(t))), requestContentLength.AsInt64())
+			responseContentLength, ok := spanAttribute(exportedSpans[0], semconv.HTTPResponseContentLengthKey)
+			t.Must.True(ok)
+			t.Must.Equal(int64(42), responseContentLength.AsInt64())
 		})
-		spanNameFn.Let(s, func(t *testcase.T) func(*http.Request) string {
-			t.Log("Given that span name generator function is provided")
-			return func(r *http.Request) string {
-				t.Must.Equal(request.Get(t), r)
-				//t.Must.Equal(request.Get(t).URL.Path, r.URL.Path, "request ")
-				return exampleSpanName.Get(t)
-			}
+
+		s.Then("unknown content lengths are not recorded", func(t *testcase.T) {
+			request.Get(t).ContentLength = -1
+			nextRoundTripper.Get(t).Response.ContentLength = -1
+			onSuccess(t)
+
+			exportedSpans := stubSpanExporter.Get(t).ExportedSpans()
+			t.Must.Equal(1, len(exportedSpans))
+			otelkit.AssertSpanLacksAttribute(t, exportedSpans[0], semconv.HTTPRequestContentLengthKey)
+			otelkit.AssertSpanLacksAttribute(t, exportedSpans[0], semconv.HTTPResponseContentLengthKey)
 		})
 
-		ThenItExportsTheRequestAttributes(s, act)
+		s.Then("zero content length with a body of unknown length is not recorded", func(t *testcase.T) {
+			req, err := http.NewRequest(http.MethodPost, request.Get(t).URL.String(), io.MultiReader(strings.NewReader("foo")))
+			t.Must.Nil(err)
+			t.Must.Equal(int64(0), req.ContentLength)
+			request.Set(t, req)
+			onSuccess(t)
 
-		s.And("error occurs in the next round tripper", func(s *testcase.Spec) {
-			expectedErr := errors.New("boom")
+			exportedSpans := stubSpanExporter.Get(t).ExportedSpans()
+			t.Must.Equal(1, len(exportedSpans))
+			otelkit.AssertSpanLacksAttribute(t, exportedSpans[0], semconv.HTTPRequestContentLengthKey)
+		})
 
-			s.Before(func(t *testcase.T) {
-				nextRoundTripper.Get(t).Err = expectedErr
-			})
+		s.Then("zero content length without a body is recorded", func(t *testcase.T) {
+			req, err := http.NewRequest(http.MethodGet, request.Get(t).URL.String(), nil)
+			t.Must.Nil(err)
+			request.Set(t, req)
+			onSuccess(t)
 
-			s.Then("error is returned", func(t *testcase.T) {
-				_, err := act(t)
-				t.Must.ErrorIs(expectedErr, err)
-			})
+			exportedSpans := stubSpanExporter.Get(t).ExportedSpans()
+			t.Must.Equal(1, len(exportedSpans))
+			otelkit.AssertSpanHasAttribute(t, exportedSpans[0], semconv.HTTPRequestContentLengthKey, attribute.Int64Value(0))
 		})
 
-		s.And("the received request has trace", func(s *testcase.Spec) {
+		s.And("the request context has tracing", func(s *testcase.Spec) {
 			GivenRequestContextHasTracing(s)
 
-			s.Then("the outbound request is propagating the tracing context", func(t *testcase.T) {
+			s.Then("the outbound span is the child of the request context's span", func(t *testcase.T) {
+				onSuccess(t)
+
+				exportedSpans := stubSpanExporter.Get(t).ExportedSpans()
+				t.Must.Equal(1, len(exportedSpans))
+				otelkit.AssertChildOfContext(t, request.Get(t).Context(), exportedSpans[0])
+			})
+		})
+
+		s.Then("the status code is recorded", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			value, ok := spanAttribute(exportedSpan(t), semconv.HTTPStatusCodeKey)
+			t.Must.True(ok)
+			t.Must.Equal(int64(nextRoundTripper.Get(t).Response.StatusCode), value.AsInt64())
+		})
+
+		s.Then("the span status is left unset on success", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.Equal(codes.Unset, exportedSpan(t).Status().Code)
+		})
+
+		s.When("the downstream responds with a client error", func(s *testcase.Spec) {
+			s.Before(func(t *testcase.T) {
+				nextRoundTripper.Get(t).Response.StatusCode = http.StatusNotFound
+			})
+
+			s.Then("the span status is left unset", func(t *testcase.T) {
 				_, err := act(t)
 				t.Must.Nil(err)
-				receivedRequest := getLastReceivedRequest(t, nextRoundTripper.Get(t).Requests)
 
-				sp := getSpanContextFromRequest(t, receivedRequest)
-				t.Must.True(sp.IsValid())
-				t.Must.Equal(spanContextConfig.Get(t).TraceID.String(), sp.TraceID().String(),
-					"the parent tracing id should be extractable from the request headers")
+				t.Must.Equal(codes.Unset, exportedSpan(t).Status().Code)
+			})
+		})
+
+		s.When("the downstream responds with a server error", func(s *testcase.Spec) {
+			s.Before(func(t *testcase.T) {
+				nextRoundTripper.Get(t).Response.StatusCode = http.StatusInternalServerError
 			})
 
-			s.Then("the oubound request is part of a newly made span context", func(t *testcase.T) {
+			s.Then("the span status is set to error with the status text", func(t *testcase.T) {
 				_, err := act(t)
 				t.Must.Nil(err)
-				receivedRequest := getLastReceivedRequest(t, nextRoundTripper.Get(t).Requests)
 
-				sp := getSpanContextFromRequest(t, receivedRequest)
-				t.Must.True(sp.IsValid())
-				t.Must.True(sp.SpanID().IsValid())
-				t.Must.NotEqual(spanContextConfig.Get(t).SpanID.String(), sp.SpanID().String(),
-					"the received span id belongs to a new span context")
+				status := exportedSpan(t).Status()
+				t.Must.Equal(codes.Error, status.Code)
+				t.Must.Equal("500 Internal Server Error", status.Description)
 			})
+		})
 
-			s.Then("after the request, trace is exported", func(t *testcase.T) {
+		s.When("the next round tripper fails with a transport error", func(s *testcase.Spec) {
+			expectedErr := testcase.Let(s, func(t *testcase.T) error { return t.Random.Error() })
+			nextRoundTripper.Let(s, func(t *testcase.T) *StubRoundTripper {
+				return &StubRoundTripper{Err: expectedErr.Get(t)}
+			})
+
+			s.Then("the error is returned, recorded, and the span is marked as failed", func(t *testcase.T) {
 				_, err := act(t)
-				t.Must.Nil(err)
+				t.Must.ErrorIs(expectedErr.Get(t), err)
 
-				t.Eventually(func(it assert.It) {
-					exportedSpans := stubSpanExporter.Get(t).ExportedSpans()
-					it.Must.True(0 < len(exportedSpans))
-					lastSpan := exportedSpans[len(exportedSpans)-1]
-					it.Logf("%#v", lastSpan)
-				})
+				span := exportedSpan(t)
+				t.Must.Equal(codes.Error, span.Status().Code)
+				t.Must.Equal(expectedErr.Get(t).Error(), span.Status().Description)
+				otelkit.AssertRecordedError(t, span, expectedErr.Get(t).Error())
 			})
 
-			s.And("the next round tripper encounters an unrecoverable error", func(s *testcase.Spec) {
-				s.Before(func(t *testcase.T) {
-					nextRoundTripper.Get(t).DoPanic = true
+			s.When("the error is redacted", func(s *testcase.Spec) {
+				redactErrorFn.Let(s, func(t *testcase.T) func(error) string {
+					return func(error) string { return "redacted" }
 				})
 
-				s.Then("panic is not swallowed up", func(t *testcase.T) {
+				s.Then("only the redacted message is recorded", func(t *testcase.T) {
+					_, err := act(t)
+					t.Must.ErrorIs(expectedErr.Get(t), err)
+
+					span := exportedSpan(t)
+					t.Must.Equal("redacted", span.Status().Description)
+					otelkit.AssertRecordedError(t, span, "redacted")
+					for _, event := range span.Events() {
+						for _, kv := range event.Attributes {
+							t.Must.NotContain(kv.Value.Emit(), expectedErr.Get(t).Error())
+						}
+					}
+				})
+			})
+		})
+
+		s.When("the request has a tenant header", func(s *testcase.Spec) {
+			s.Before(func(t *testcase.T) {
+				request.Get(t).Header.Set("X-Tenant-ID", "acme")
+			})
+
+			s.Then("only the semantic convention attributes are recorded by default", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.Nil(err)
+
+				otelkit.AssertSpanLacksAttribute(t, exportedSpan(t), "tenant.id")
+			})
+
+			s.When("attributes function is provided", func(s *testcase.Spec) {
+				attributesFn.Let(s, func(t *testcase.T) func(*http.Request) []attribute.KeyValue {
+					return func(r *http.Request) []attribute.KeyValue {
+						t.Must.Equal(request.Get(t), r)
+						return []attribute.KeyValue{attribute.String("tenant.id", r.Header.Get("X-Tenant-ID"))}
+					}
+				})
+
+				s.Then("its attributes are recorded along with the semantic convention attributes", func(t *testcase.T) {
+					_, err := act(t)
+					t.Must.Nil(err)
+
+					span := exportedSpan(t)
+					value, ok := spanAttribute(span, "tenant.id")
+					t.Must.True(ok)
+					t.Must.Equal("acme", value.AsString())
+					_, ok = spanAttribute(span, semconv.HTTPMethodKey)
+					t.Must.True(ok)
+				})
+			})
+		})
+
+		s.When("context attributes are recorded", func(s *testcase.Spec) {
+			contextAttributesCount := testcase.LetValue(s, 10)
+			contextAttributesFn.Let(s, func(t *testcase.T) func(context.Context) []attribute.KeyValue {
+				return func(ctx context.Context) []attribute.KeyValue {
+					var attrs []attribute.KeyValue
+					for i := 0; i < contextAttributesCount.Get(t); i++ {
+						attrs = append(attrs, attribute.Int(fmt.Sprintf("attr.%d", i), i))
+					}
+					return attrs
+				}
+			})
+
+			truncatedKey := attribute.Key("otelkit.attributes_truncated")
+
+			s.Then("all attributes are recorded by default", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.Nil(err)
+
+				span := exportedSpan(t)
+				_, ok := spanAttribute(span, "attr.9")
+				t.Must.True(ok)
+				_, ok = spanAttribute(span, truncatedKey)
+				t.Must.False(ok)
+			})
+
+			s.When("attribute limit is exceeded", func(s *testcase.Spec) {
+				attributeLimit.LetValue(s, 8)
+
+				s.Then("only the attributes within the limit are recorded, with a truncation marker", func(t *testcase.T) {
+					_, err := act(t)
+					t.Must.Nil(err)
+
+					span := exportedSpan(t)
+					var contextAttrs int
+					for _, kv := range span.Attributes() {
+						if strings.HasPrefix(string(kv.Key), "attr.") {
+							contextAttrs++
+						}
+					}
+					t.Must.Equal(2, contextAttrs, "only the context attributes that fit within the limit are recorded")
+					_, ok := spanAttribute(span, semconv.HTTPMethodKey)
+					t.Must.True(ok, "the default attributes come first")
+					_, ok = spanAttribute(span, "attr.1")
+					t.Must.True(ok)
+					_, ok = spanAttribute(span, "attr.2")
+					t.Must.False(ok)
+					value, ok := spanAttribute(span, truncatedKey)
+					t.Must.True(ok)
+					t.Must.True(value.AsBool())
+				})
+			})
+
+			s.When("attribute limit is reached by the start attributes", func(s *testcase.Spec) {
+				attributeLimit.LetValue(s, 2)
+
+				s.Then("the attributes recorded after the round trip are dropped too", func(t *testcase.T) {
+					_, err := act(t)
+					t.Must.Nil(err)
+
+					span := exportedSpan(t)
+					t.Must.Equal(3, len(span.Attributes()), "the limit and the truncation marker")
+					otelkit.AssertSpanLacksAttribute(t, span, semconv.HTTPStatusCodeKey)
+					otelkit.AssertSpanHasAttribute(t, span, truncatedKey, attribute.BoolValue(true))
+				})
+			})
+
+			s.When("attribute limit is reached by the attributes recorded after the round trip", func(s *testcase.Spec) {
+				attributeLimit.LetValue(s, 6)
+				contextAttributesCount.LetValue(s, 0)
+
+				s.Then("the span is marked as truncated when they are dropped", func(t *testcase.T) {
+					_, err := act(t)
+					t.Must.Nil(err)
+
+					span := exportedSpan(t)
+					t.Must.Equal(7, len(span.Attributes()), "the limit and the truncation marker")
+					otelkit.AssertSpanLacksAttribute(t, span, semconv.HTTPStatusCodeKey)
+					otelkit.AssertSpanHasAttribute(t, span, truncatedKey, attribute.BoolValue(true))
+				})
+			})
+
+			s.When("attribute limit is not exceeded", func(s *testcase.Spec) {
+				attributeLimit.LetValue(s, 100)
+
+				s.Then("no truncation marker is recorded", func(t *testcase.T) {
+					_, err := act(t)
+					t.Must.Nil(err)
+
+					_, ok := spanAttribute(exportedSpan(t), truncatedKey)
+					t.Must.False(ok)
+				})
+			})
+		})
+
+		s.When("the request URL has query parameters", func(s *testcase.Spec) {
+			request.Let(s, func(t *testcase.T) *http.Request {
+				return httptest.NewRequest(http.MethodGet, "https://example.com/?flag=on&tag=a&tag=b&token=secret", nil)
+			})
+
+			queryAttributeCount := func(span traceSDK.ReadOnlySpan) int {
+				var n int
+				for _, kv := range span.Attributes() {
+					if strings.HasPrefix(string(kv.Key), "http.request.query.") {
+						n++
+					}
+				}
+				return n
+			}
+
+			s.Then("no query parameter is recorded by default", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.Nil(err)
+
+				t.Must.Equal(0, queryAttributeCount(exportedSpan(t)))
+			})
+
+			s.When("query parameters are allowed to be recorded", func(s *testcase.Spec) {
+				recordQueryParams.Let(s, func(t *testcase.T) []string { return []string{"tag", "missing"} })
+
+				s.Then("only the present allowed parameters are recorded", func(t *testcase.T) {
+					_, err := act(t)
+					t.Must.Nil(err)
+
+					span := exportedSpan(t)
+					t.Must.Equal(1, queryAttributeCount(span))
+					tag, ok := spanAttribute(span, "http.request.query.tag")
+					t.Must.True(ok)
+					t.Must.Equal([]string{"a", "b"}, tag.AsStringSlice())
+				})
+
+				s.Then("the parameters that are not allowed appear in no attribute, including http.url", func(t *testcase.T) {
+					_, err := act(t)
+					t.Must.Nil(err)
+
+					span := exportedSpan(t)
+					assertNoAttributeContains(t, span, "secret")
+					otelkit.AssertSpanHasAttribute(t, span, semconv.HTTPURLKey, attribute.StringValue("https://example.com/"))
+				})
+			})
+		})
+
+		s.When("response size recording is enabled", func(s *testcase.Spec) {
+			recordResponseSize.LetValue(s, true)
+			nextRoundTripper.Let(s, func(t *testcase.T) *StubRoundTripper {
+				return &StubRoundTripper{Response: &http.Response{
+					StatusCode:    http.StatusOK,
+					Header:        http.Header{"Set-Cookie": {"a=1", "b=22"}, "Content-Type": {"text/plain"}},
+					ContentLength: 1024,
+				}}
+			})
+
+			s.Then("header and body sizes are recorded separately", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.Nil(err)
+
+				span := exportedSpan(t)
+				headerBytes, ok := spanAttribute(span, "otelkit.http.response.header_bytes")
+				t.Must.True(ok)
+				t.Must.Equal(int64(len("Set-Cookie")*2+len("a=1")+len("b=22")+len("Content-Type")+len("text/plain")), headerBytes.AsInt64())
+				bodyBytes, ok := spanAttribute(span, "otelkit.http.response.body_bytes")
+				t.Must.True(ok)
+				t.Must.Equal(int64(1024), bodyBytes.AsInt64())
+			})
+
+			s.When("the content length is unknown", func(s *testcase.Spec) {
+				nextRoundTripper.Let(s, func(t *testcase.T) *StubRoundTripper {
+					return &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, ContentLength: -1}}
+				})
+
+				s.Then("only the header size is recorded", func(t *testcase.T) {
+					_, err := act(t)
+					t.Must.Nil(err)
+
+					span := exportedSpan(t)
+					headerBytes, ok := spanAttribute(span, "otelkit.http.response.header_bytes")
+					t.Must.True(ok)
+					t.Must.Equal(int64(0), headerBytes.AsInt64())
+					_, ok = spanAttribute(span, "otelkit.http.response.body_bytes")
+					t.Must.False(ok)
+				})
+			})
+
+			s.When("the option is disabled", func(s *testcase.Spec) {
+				recordResponseSize.LetValue(s, false)
+
+				s.Then("no size is recorded", func(t *testcase.T) {
+					_, err := act(t)
+					t.Must.Nil(err)
+
+					span := exportedSpan(t)
+					_, ok := spanAttribute(span, "otelkit.http.response.header_bytes")
+					t.Must.False(ok)
+					_, ok = spanAttribute(span, "otelkit.http.response.body_bytes")
+					t.Must.False(ok)
+				})
+			})
+		})
+	})
+
+	s.When("span function is provided", func(s *testcase.Spec) {
+		s.Before(func(t *testcase.T) {
+			t.Skip()
+		})
+		spanNameFn.Let(s, func(t *testcase.T) func(*http.Request) string {
+			t.Log("Given that span name generator function is provided")
+			return func(r *http.Request) string {
+				t.Must.Equal(request.Get(t), r)
+				//t.Must.Equal(request.Get(t).URL.Path, r.URL.Path, "request ")
+				return exampleSpanName.Get(t)
+			}
+		})
+
+		ThenItExportsTheRequestAttributes(s, act)
+
+		s.And("error occurs in the next round tripper", func(s *testcase.Spec) {
+			expectedErr := errors.New("boom")
+
+			s.Before(func(t *testcase.T) {
+				nextRoundTripper.Get(t).Err = expectedErr
+			})
+
+			s.Then("error is returned", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.ErrorIs(expectedErr, err)
+			})
+		})
+
+		s.And("the received request has trace", func(s *testcase.Spec) {
+			GivenRequestContextHasTracing(s)
+
+			s.Then("the outbound request is propagating the tracing context", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.Nil(err)
+				receivedRequest := getLastReceivedRequest(t, nextRoundTripper.Get(t).Requests)
+
+				sp := getSpanContextFromRequest(t, receivedRequest)
+				t.Must.True(sp.IsValid())
+				t.Must.Equal(spanContextConfig.Get(t).TraceID.String(), sp.TraceID().String(),
+					"the parent tracing id should be extractable from the request headers")
+			})
+
+			s.Then("the oubound request is part of a newly made span context", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.Nil(err)
+				receivedRequest := getLastReceivedRequest(t, nextRoundTripper.Get(t).Requests)
+
+				sp := getSpanContextFromRequest(t, receivedRequest)
+				t.Must.True(sp.IsValid())
+				t.Must.True(sp.SpanID().IsValid())
+				t.Must.NotEqual(spanContextConfig.Get(t).SpanID.String(), sp.SpanID().String(),
+					"the received span id belongs to a new span context")
+			})
+
+			s.Then("after the request, trace is exported", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.Nil(err)
+
+				t.Eventually(func(it assert.It) {
+					exportedSpans := stubSpanExporter.Get(t).ExportedSpans()
+					it.Must.True(0 < len(exportedSpans))
+					lastSpan := exportedSpans[len(exportedSpans)-1]
+					it.Log(otelkit.SpanSummary(lastSpan))
+				})
+			})
+
+			s.And("the next round tripper encounters an unrecoverable error", func(s *testcase.Spec) {
+				s.Before(func(t *testcase.T) {
+					nextRoundTripper.Get(t).DoPanic = true
+				})
+
+				s.Then("panic is not swallowed up", func(t *testcase.T) {
 					t.Must.Panic(func() { _, _ = act(t) })
 				})
 
@@ -464,7 +1301,7 @@ func TestHTTPRoundTripper(t *testing.T) {
 						exportedSpans := stubSpanExporter.Get(t).ExportedSpans()
 						it.Must.True(0 < len(exportedSpans))
 						lastSpan := exportedSpans[len(exportedSpans)-1]
-						it.Logf("%#v", lastSpan)
+						it.Log(otelkit.SpanSummary(lastSpan))
 					})
 				})
 			})
@@ -622,3 +1459,1843 @@ func TestContextWithBaggage_smoke(t *testing.T) {
 		assert.Error(t, expErr, err)
 	})
 }
+
+func TestHTTPMiddlewareRecovery_ServeHTTP(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	var (
+		rePanic        = testcase.LetValue(s, false)
+		withStackTrace = testcase.LetValue(s, false)
+		events         = testcase.LetValue[[]otelkit.RecoveryEvent](s, nil)
+	)
+	makeSubject := func(t *testcase.T, next http.Handler) http.Handler {
+		return otelkit.HTTPMiddlewareRecovery{
+			Next:           next,
+			RePanic:        rePanic.Get(t),
+			WithStackTrace: withStackTrace.Get(t),
+			NotifyFn: func(event otelkit.RecoveryEvent) {
+				events.Set(t, append(events.Get(t), event))
+			},
+		}
+	}
+
+	ItBehavesLikeAMiddleware(s, makeSubject)
+
+	s.When("the next handler panics", func(s *testcase.Spec) {
+		panicValue := testcase.Let(s, func(t *testcase.T) string {
+			return t.Random.String()
+		})
+		span := testcase.Let(s, func(t *testcase.T) trace.Span {
+			ctx, span := tracer.Get(t).Start(request.Get(t).Context(), exampleSpanName.Get(t))
+			request.Set(t, request.Get(t).WithContext(ctx))
+			return span
+		}).EagerLoading(s)
+		act := func(t *testcase.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(panicValue.Get(t)) })
+			makeSubject(t, next).ServeHTTP(responseRecorder.Get(t), request.Get(t))
+		}
+		thenSpanRecordsTheError := func(t *testcase.T) {
+			span.Get(t).End()
+			spans := stubSpanExporter.Get(t).ExportedSpans()
+			t.Must.Equal(1, len(spans))
+			t.Must.Equal(codes.Error, spans[0].Status().Code)
+			t.Must.Contain(spans[0].Status().Description, panicValue.Get(t))
+			otelkit.AssertRecordedError(t, spans[0], panicValue.Get(t))
+		}
+
+		s.Then("panic is swallowed and internal server error is returned", func(t *testcase.T) {
+			act(t)
+
+			t.Must.Equal(http.StatusInternalServerError, responseRecorder.Get(t).Code)
+		})
+
+		s.Then("the span records the error", func(t *testcase.T) {
+			act(t)
+
+			thenSpanRecordsTheError(t)
+		})
+
+		s.Then("the panic is notified", func(t *testcase.T) {
+			act(t)
+
+			t.Must.Equal(1, len(events.Get(t)))
+			event := events.Get(t)[0]
+			t.Must.Equal(any(panicValue.Get(t)), event.Panic)
+			t.Must.Contain(event.Err.Error(), panicValue.Get(t))
+			t.Must.Equal(request.Get(t).URL.String(), event.Request.URL.String())
+		})
+
+		s.Then("the stack trace is not recorded by default", func(t *testcase.T) {
+			act(t)
+			span.Get(t).End()
+
+			spans := stubSpanExporter.Get(t).ExportedSpans()
+			t.Must.Equal(1, len(spans))
+			otelkit.AssertSpanLacksAttribute(t, spans[0], semconv.ExceptionStacktraceKey)
+		})
+
+		s.And("stack trace recording is enabled", func(s *testcase.Spec) {
+			withStackTrace.LetValue(s, true)
+
+			s.Then("the stack trace of the panic is recorded on the span", func(t *testcase.T) {
+				act(t)
+				span.Get(t).End()
+
+				spans := stubSpanExporter.Get(t).ExportedSpans()
+				t.Must.Equal(1, len(spans))
+				value, ok := spanAttribute(spans[0], semconv.ExceptionStacktraceKey)
+				t.Must.True(ok)
+				t.Must.Contain(value.AsString(), "TestHTTPMiddlewareRecovery_ServeHTTP")
+			})
+
+			s.Then("internal server error is still returned", func(t *testcase.T) {
+				act(t)
+
+				t.Must.Equal(http.StatusInternalServerError, responseRecorder.Get(t).Code)
+			})
+		})
+
+		s.And("re-panic is enabled", func(s *testcase.Spec) {
+			rePanic.LetValue(s, true)
+
+			s.Then("the original panic value is raised again", func(t *testcase.T) {
+				out := assert.Panic(t, func() { act(t) })
+				t.Must.Equal(any(panicValue.Get(t)), out)
+			})
+
+			s.Then("the span still records the error", func(t *testcase.T) {
+				assert.Panic(t, func() { act(t) })
+
+				thenSpanRecordsTheError(t)
+			})
+
+			s.Then("the panic is still notified", func(t *testcase.T) {
+				assert.Panic(t, func() { act(t) })
+
+				t.Must.Equal(1, len(events.Get(t)))
+			})
+		})
+	})
+}
+
+func TestHTTPRoundTripper_RecordResponseContentType(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	var (
+		recordContentType = testcase.LetValue(s, true)
+		nextRoundTripper  = testcase.Let(s, func(t *testcase.T) *StubRoundTripper {
+			return &StubRoundTripper{Response: &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+			}}
+		})
+	)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:                      nextRoundTripper.Get(t),
+			Propagator:                propagator.Get(t),
+			Tracer:                    tracer.Get(t),
+			RecordResponseContentType: recordContentType.Get(t),
+		}.RoundTrip(request.Get(t))
+	}
+	lastSpan := func(t *testcase.T) traceSDK.ReadOnlySpan {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.NotEmpty(spans)
+		return spans[len(spans)-1]
+	}
+
+	s.Then("the response content type is recorded", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		value, ok := spanAttribute(lastSpan(t), "http.response.header.content_type")
+		t.Must.True(ok)
+		t.Must.Equal("application/json", value.AsString())
+	})
+
+	s.When("the option is disabled", func(s *testcase.Spec) {
+		recordContentType.LetValue(s, false)
+
+		s.Then("content type is not recorded", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			_, ok := spanAttribute(lastSpan(t), "http.response.header.content_type")
+			t.Must.False(ok)
+		})
+	})
+
+	s.When("the next round tripper fails without a response", func(s *testcase.Spec) {
+		expErr := errors.New("boom")
+		nextRoundTripper.Let(s, func(t *testcase.T) *StubRoundTripper {
+			return &StubRoundTripper{Err: expErr}
+		})
+
+		s.Then("error is returned without recording the content type", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.ErrorIs(expErr, err)
+
+			_, ok := spanAttribute(lastSpan(t), "http.response.header.content_type")
+			t.Must.False(ok)
+		})
+	})
+}
+
+func TestHTTPMiddlewareTracing_ServeHTTP(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	tracerProvider.Let(s, func(t *testcase.T) trace.TracerProvider {
+		return traceSDK.NewTracerProvider(
+			traceSDK.WithSampler(traceSDK.AlwaysSample()),
+			traceSDK.WithSpanProcessor(traceSDK.NewSimpleSpanProcessor(stubSpanExporter.Get(t))))
+	})
+
+	var (
+		routeFn           = testcase.LetValue[func(*http.Request) string](s, nil)
+		newRootWithLink   = testcase.LetValue(s, false)
+		recordQueryParams = testcase.LetValue[[]string](s, nil)
+	)
+	makeSubject := func(t *testcase.T, next http.Handler) http.Handler {
+		return otelkit.HTTPMiddlewareTracing{
+			Next:              next,
+			Propagator:        propagator.Get(t),
+			Tracer:            tracer.Get(t),
+			RouteFn:           routeFn.Get(t),
+			NewRootWithLink:   newRootWithLink.Get(t),
+			RecordQueryParams: recordQueryParams.Get(t),
+		}
+	}
+	act := func(t *testcase.T) {
+		makeSubject(t, stubHandler.Get(t)).ServeHTTP(responseRecorder.Get(t), request.Get(t))
+	}
+	serverSpan := func(t *testcase.T) traceSDK.ReadOnlySpan {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spans[0]
+	}
+
+	ItBehavesLikeAMiddleware(s, makeSubject)
+
+	s.Then("a server span is started for the next handler", func(t *testcase.T) {
+		act(t)
+
+		receivedRequest := getLastReceivedRequest(t, stubHandler.Get(t).Requests)
+		sc := trace.SpanContextFromContext(receivedRequest.Context())
+		t.Must.True(sc.IsValid())
+		t.Must.Equal(sc.SpanID(), serverSpan(t).SpanContext().SpanID())
+		t.Must.Equal(trace.SpanKindServer, serverSpan(t).SpanKind())
+	})
+
+	s.Then("the sampling decision of the local sampler is recorded", func(t *testcase.T) {
+		act(t)
+
+		value, ok := spanAttribute(serverSpan(t), "otelkit.sampling.sampled")
+		t.Must.True(ok)
+		t.Must.True(value.AsBool())
+	})
+
+	s.Then("without inbound tracing, parent sampling is not recorded", func(t *testcase.T) {
+		act(t)
+
+		_, ok := spanAttribute(serverSpan(t), "otelkit.sampling.parent_sampled")
+		t.Must.False(ok)
+	})
+
+	s.Then("without inbound tracing, new root with link makes no links", func(t *testcase.T) {
+		newRootWithLink.Set(t, true)
+		act(t)
+
+		t.Must.Empty(serverSpan(t).Links())
+	})
+
+	s.Then("without a route resolver, http.route is not recorded", func(t *testcase.T) {
+		act(t)
+
+		_, ok := spanAttribute(serverSpan(t), semconv.HTTPRouteKey)
+		t.Must.False(ok)
+	})
+
+	s.When("route resolver is provided", func(s *testcase.Spec) {
+		routeFn.Let(s, func(t *testcase.T) func(*http.Request) string {
+			return func(r *http.Request) string {
+				t.Must.Equal(request.Get(t).URL.Path, r.URL.Path)
+				return "/resources/{id}"
+			}
+		})
+
+		ItBehavesLikeAMiddleware(s, makeSubject)
+
+		s.Then("the resolved route is recorded as http.route", func(t *testcase.T) {
+			act(t)
+
+			value, ok := spanAttribute(serverSpan(t), semconv.HTTPRouteKey)
+			t.Must.True(ok)
+			t.Must.Equal("/resources/{id}", value.AsString())
+		})
+
+		s.Then("the span name stays independent from the route", func(t *testcase.T) {
+			act(t)
+
+			t.Must.NotEqual("/resources/{id}", serverSpan(t).Name())
+		})
+	})
+
+	s.When("the received request has trace", func(s *testcase.Spec) {
+		sampled := testcase.LetValue(s, true)
+		spanContextConfig.Let(s, func(t *testcase.T) trace.SpanContextConfig {
+			config := spanContextConfig.Super(t)
+			if sampled.Get(t) {
+				config.TraceFlags = trace.FlagsSampled
+			}
+			return config
+		})
+		GivenRequestHeaderHasTracing(s)
+
+		s.Then("the server span continues the inbound trace", func(t *testcase.T) {
+			act(t)
+
+			t.Must.Equal(spanContextConfig.Get(t).TraceID, serverSpan(t).SpanContext().TraceID())
+			t.Must.Equal(spanContextConfig.Get(t).SpanID, serverSpan(t).Parent().SpanID())
+		})
+
+		s.Then("the server span has no links", func(t *testcase.T) {
+			act(t)
+
+			t.Must.Empty(serverSpan(t).Links())
+		})
+
+		s.And("new root with link is requested", func(s *testcase.Spec) {
+			newRootWithLink.LetValue(s, true)
+
+			ItBehavesLikeAMiddleware(s, makeSubject)
+
+			s.Then("the server span starts a new trace", func(t *testcase.T) {
+				act(t)
+
+				t.Must.NotEqual(spanContextConfig.Get(t).TraceID, serverSpan(t).SpanContext().TraceID())
+				t.Must.False(serverSpan(t).Parent().IsValid())
+			})
+
+			s.Then("the server span links to the inbound span context", func(t *testcase.T) {
+				act(t)
+
+				links := serverSpan(t).Links()
+				t.Must.Equal(1, len(links))
+				t.Must.Equal(spanContextConfig.Get(t).TraceID, links[0].SpanContext.TraceID())
+				t.Must.Equal(spanContextConfig.Get(t).SpanID, links[0].SpanContext.SpanID())
+			})
+		})
+
+		s.Then("the inbound sampling decision is recorded", func(t *testcase.T) {
+			act(t)
+
+			value, ok := spanAttribute(serverSpan(t), "otelkit.sampling.parent_sampled")
+			t.Must.True(ok)
+			t.Must.True(value.AsBool())
+		})
+
+		s.And("the inbound trace was not sampled", func(s *testcase.Spec) {
+			sampled.LetValue(s, false)
+
+			s.Then("it is recorded that the local sampler kept it regardless", func(t *testcase.T) {
+				act(t)
+
+				parentSampled, ok := spanAttribute(serverSpan(t), "otelkit.sampling.parent_sampled")
+				t.Must.True(ok)
+				t.Must.False(parentSampled.AsBool())
+				localSampled, ok := spanAttribute(serverSpan(t), "otelkit.sampling.sampled")
+				t.Must.True(ok)
+				t.Must.True(localSampled.AsBool())
+			})
+		})
+	})
+
+	s.When("query parameters are allowed to be recorded", func(s *testcase.Spec) {
+		recordQueryParams.Let(s, func(t *testcase.T) []string { return []string{"flag", "tag"} })
+		request.Let(s, func(t *testcase.T) *http.Request {
+			return httptest.NewRequest(http.MethodGet, "/?flag=on&tag=a&tag=b&token=secret", nil)
+		})
+
+		s.Then("only the allowed parameters are recorded, with all of their values", func(t *testcase.T) {
+			act(t)
+
+			span := serverSpan(t)
+			flag, ok := spanAttribute(span, "http.request.query.flag")
+			t.Must.True(ok)
+			t.Must.Equal([]string{"on"}, flag.AsStringSlice())
+			tag, ok := spanAttribute(span, "http.request.query.tag")
+			t.Must.True(ok)
+			t.Must.Equal([]string{"a", "b"}, tag.AsStringSlice())
+			_, ok = spanAttribute(span, "http.request.query.token")
+			t.Must.False(ok)
+		})
+
+		s.Then("the parameters that are not allowed appear in no attribute, including http.target", func(t *testcase.T) {
+			act(t)
+
+			span := serverSpan(t)
+			assertNoAttributeContains(t, span, "secret")
+			otelkit.AssertSpanHasAttribute(t, span, semconv.HTTPTargetKey, attribute.StringValue("/"))
+		})
+	})
+}
+
+func assertNoAttributeContains(t *testcase.T, span traceSDK.ReadOnlySpan, value string) {
+	t.Helper()
+	for _, kv := range span.Attributes() {
+		t.Must.NotContain(kv.Value.Emit(), value, fmt.Sprintf("attribute %q leaks %q", kv.Key, value))
+	}
+}
+
+func TestHTTPRoundTripper_TracerProvider(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	var (
+		tracerField            = testcase.LetValue[trace.Tracer](s, nil)
+		instrumentationName    = testcase.LetValue(s, "")
+		instrumentationVersion = testcase.LetValue(s, "")
+	)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:                   &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}},
+			Propagator:             propagator.Get(t),
+			Tracer:                 tracerField.Get(t),
+			TracerProvider:         tracerProvider.Get(t),
+			InstrumentationName:    instrumentationName.Get(t),
+			InstrumentationVersion: instrumentationVersion.Get(t),
+		}.RoundTrip(request.Get(t))
+	}
+
+	s.Then("the tracer is obtained from the tracer provider with the default instrumentation name", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		t.Must.Equal("github.com/adamluzsi/otelkit", exportedSpan(t).InstrumentationScope().Name)
+		t.Must.Equal(otelkit.Version, exportedSpan(t).InstrumentationScope().Version)
+	})
+
+	s.When("instrumentation version is configured", func(s *testcase.Spec) {
+		instrumentationVersion.LetValue(s, "1.2.3")
+
+		s.Then("the tracer is obtained with the configured version", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.Equal("1.2.3", exportedSpan(t).InstrumentationScope().Version)
+		})
+	})
+
+	s.When("instrumentation name is configured", func(s *testcase.Spec) {
+		instrumentationName.Let(s, func(t *testcase.T) string {
+			return t.Random.StringNC(8, random.CharsetAlpha())
+		})
+
+		s.Then("the tracer is obtained with the configured name", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.Equal(instrumentationName.Get(t), exportedSpan(t).InstrumentationScope().Name)
+		})
+
+		s.Then("the otelkit version is not assumed for the custom instrumentation", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.Empty(exportedSpan(t).InstrumentationScope().Version)
+		})
+	})
+
+	s.When("tracer is also provided", func(s *testcase.Spec) {
+		tracerField.Let(s, func(t *testcase.T) trace.Tracer {
+			return tracer.Get(t)
+		})
+
+		s.Then("the tracer takes precedence", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.Equal(exampleInstrumentationName.Get(t), exportedSpan(t).InstrumentationScope().Name)
+		})
+	})
+}
+
+func TestHTTPRoundTripper_RecordTimingEvents(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	recordTimingEvents := testcase.LetValue(s, true)
+	server := testcase.Let(s, func(t *testcase.T) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+		t.Defer(srv.Close)
+		return srv
+	})
+	act := func(t *testcase.T) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, server.Get(t).URL, nil)
+		t.Must.Nil(err)
+		resp, err := otelkit.HTTPRoundTripper{
+			Next:               server.Get(t).Client().Transport,
+			Propagator:         propagator.Get(t),
+			Tracer:             tracer.Get(t),
+			RecordTimingEvents: recordTimingEvents.Get(t),
+		}.RoundTrip(req)
+		if err == nil {
+			t.Defer(resp.Body.Close)
+		}
+		return resp, err
+	}
+	eventNames := func(t *testcase.T) []string {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		var names []string
+		for _, event := range spans[0].Events() {
+			names = append(names, event.Name)
+		}
+		return names
+	}
+
+	s.Then("dispatch and first response byte events are recorded in order", func(t *testcase.T) {
+		resp, err := act(t)
+		t.Must.Nil(err)
+		t.Must.Equal(http.StatusTeapot, resp.StatusCode)
+
+		t.Must.Equal([]string{"otelkit.http.request.dispatched", "otelkit.http.response.first_byte"}, eventNames(t))
+	})
+
+	s.When("the option is disabled", func(s *testcase.Spec) {
+		recordTimingEvents.LetValue(s, false)
+
+		s.Then("no timing event is recorded", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.Empty(eventNames(t))
+		})
+	})
+}
+
+func TestHTTPRoundTripper_RecordTimingBreakdown(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	recordTimingBreakdown := testcase.LetValue(s, true)
+	server := testcase.Let(s, func(t *testcase.T) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(10 * time.Millisecond)
+			w.WriteHeader(http.StatusTeapot)
+		}))
+		t.Defer(srv.Close)
+		return srv
+	})
+	act := func(t *testcase.T) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, server.Get(t).URL, nil)
+		t.Must.Nil(err)
+		resp, err := otelkit.HTTPRoundTripper{
+			Next:                  server.Get(t).Client().Transport,
+			Propagator:            propagator.Get(t),
+			Tracer:                tracer.Get(t),
+			RecordTimingBreakdown: recordTimingBreakdown.Get(t),
+		}.RoundTrip(req)
+		if err == nil {
+			t.Defer(resp.Body.Close)
+		}
+		return resp, err
+	}
+
+	s.Then("connection and time to first byte durations are recorded in milliseconds", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		span := exportedSpan(t)
+		connect, ok := spanAttribute(span, "otelkit.http.connect_ms")
+		t.Must.True(ok)
+		t.Must.True(0 <= connect.AsFloat64())
+		ttfb, ok := spanAttribute(span, "otelkit.http.ttfb_ms")
+		t.Must.True(ok)
+		t.Must.True(10 <= ttfb.AsFloat64(), "the time spent by the downstream is part of time to first byte")
+	})
+
+	s.When("the option is disabled", func(s *testcase.Spec) {
+		recordTimingBreakdown.LetValue(s, false)
+
+		s.Then("no breakdown is recorded", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			span := exportedSpan(t)
+			_, ok := spanAttribute(span, "otelkit.http.connect_ms")
+			t.Must.False(ok)
+			_, ok = spanAttribute(span, "otelkit.http.ttfb_ms")
+			t.Must.False(ok)
+		})
+	})
+}
+
+func TestHTTPRoundTripper_RecordErrorAttribute(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	var (
+		expectedErr          = testcase.Let(s, func(t *testcase.T) error { return t.Random.Error() })
+		recordErrorAttribute = testcase.LetValue(s, true)
+		redactErrorFn        = testcase.LetValue[func(error) string](s, nil)
+	)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:                 &StubRoundTripper{Err: expectedErr.Get(t)},
+			Propagator:           propagator.Get(t),
+			Tracer:               tracer.Get(t),
+			RecordErrorAttribute: recordErrorAttribute.Get(t),
+			RedactErrorFn:        redactErrorFn.Get(t),
+		}.RoundTrip(request.Get(t))
+	}
+	errorAttribute := func(t *testcase.T) (attribute.Value, bool) {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spanAttribute(spans[0], "otelkit.error")
+	}
+
+	s.Then("the error message is recorded as otelkit.error", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.ErrorIs(expectedErr.Get(t), err)
+
+		value, ok := errorAttribute(t)
+		t.Must.True(ok)
+		t.Must.Equal(expectedErr.Get(t).Error(), value.AsString())
+	})
+
+	s.When("redaction function is provided", func(s *testcase.Spec) {
+		redactErrorFn.Let(s, func(t *testcase.T) func(error) string {
+			return func(err error) string {
+				t.Must.ErrorIs(expectedErr.Get(t), err)
+				return "[REDACTED]"
+			}
+		})
+
+		s.Then("the redacted message is recorded", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.ErrorIs(expectedErr.Get(t), err)
+
+			value, ok := errorAttribute(t)
+			t.Must.True(ok)
+			t.Must.Equal("[REDACTED]", value.AsString())
+		})
+	})
+
+	s.When("the option is disabled", func(s *testcase.Spec) {
+		recordErrorAttribute.LetValue(s, false)
+
+		s.Then("the error attribute is not recorded", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.ErrorIs(expectedErr.Get(t), err)
+
+			_, ok := errorAttribute(t)
+			t.Must.False(ok)
+		})
+	})
+}
+
+func TestHTTPRoundTripper_SpanContextFn(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	var (
+		nextRoundTripper = testcase.Let(s, func(t *testcase.T) *StubRoundTripper {
+			return &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}}
+		})
+		observed = testcase.LetValue[[]trace.SpanContext](s, nil)
+	)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:       nextRoundTripper.Get(t),
+			Propagator: propagator.Get(t),
+			Tracer:     tracer.Get(t),
+			SpanContextFn: func(r *http.Request, sc trace.SpanContext) {
+				t.Must.Equal(request.Get(t), r)
+				observed.Set(t, append(observed.Get(t), sc))
+			},
+		}.RoundTrip(request.Get(t))
+	}
+
+	GivenRequestContextHasTracing(s)
+
+	s.Then("the caller observes the child span context of the outbound request", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		t.Must.Equal(1, len(observed.Get(t)))
+		sc := observed.Get(t)[0]
+		t.Must.True(sc.IsValid())
+		t.Must.Equal(spanContextConfig.Get(t).TraceID, sc.TraceID())
+		t.Must.NotEqual(spanContextConfig.Get(t).SpanID, sc.SpanID())
+
+		receivedRequest := getLastReceivedRequest(t, nextRoundTripper.Get(t).Requests)
+		t.Must.Equal(sc.SpanID(), getSpanContextFromRequest(t, receivedRequest).SpanID(),
+			"the observed span context is the one propagated to the downstream")
+	})
+}
+
+func TestHTTPRoundTripper_SkipInject(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	var (
+		nextRoundTripper = testcase.Let(s, func(t *testcase.T) *StubRoundTripper {
+			return &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}}
+		})
+		skipInject = testcase.LetValue(s, true)
+	)
+	makeSubject := func(t *testcase.T, next http.RoundTripper) http.RoundTripper {
+		return otelkit.HTTPRoundTripper{
+			Next:       next,
+			Propagator: propagator.Get(t),
+			Tracer:     tracer.Get(t),
+			SkipInject: skipInject.Get(t),
+		}
+	}
+	act := func(t *testcase.T) (*http.Response, error) {
+		return makeSubject(t, nextRoundTripper.Get(t)).RoundTrip(request.Get(t))
+	}
+
+	GivenRequestContextHasTracing(s)
+	ItBehavesLikeARoundTripper(s, makeSubject)
+
+	s.Then("the client span is still recorded", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		t.Must.Equal(1, len(stubSpanExporter.Get(t).ExportedSpans()))
+	})
+
+	s.Then("tracing is not injected into the outbound request", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		receivedRequest := getLastReceivedRequest(t, nextRoundTripper.Get(t).Requests)
+		t.Must.Empty(receivedRequest.Header.Get(traceParentHeaderKey))
+	})
+
+	s.When("injection is not skipped", func(s *testcase.Spec) {
+		skipInject.LetValue(s, false)
+
+		s.Then("tracing is injected into the outbound request", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			receivedRequest := getLastReceivedRequest(t, nextRoundTripper.Get(t).Requests)
+			t.Must.NotEmpty(receivedRequest.Header.Get(traceParentHeaderKey))
+		})
+	})
+}
+
+func TestHTTPRoundTripper_Timeout(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	var (
+		timeout          = testcase.LetValue(s, time.Millisecond)
+		receivedRequests = testcase.LetValue[[]*http.Request](s, nil)
+		next             = testcase.Let(s, func(t *testcase.T) http.RoundTripper {
+			return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				receivedRequests.Set(t, append(receivedRequests.Get(t), r))
+				<-r.Context().Done()
+				return nil, r.Context().Err()
+			})
+		})
+	)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:       next.Get(t),
+			Propagator: propagator.Get(t),
+			Tracer:     tracer.Get(t),
+			Timeout:    timeout.Get(t),
+		}.RoundTrip(request.Get(t))
+	}
+	timeoutEvents := func(t *testcase.T) int {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return stubSpanExporter.Get(t).EventCount("otelkit.timeout")
+	}
+
+	s.Then("the request is cancelled after the timeout and it is recorded as an event", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.ErrorIs(context.DeadlineExceeded, err)
+
+		t.Must.Equal(1, timeoutEvents(t))
+	})
+
+	s.When("the request context's own deadline is exceeded first", func(s *testcase.Spec) {
+		timeout.LetValue(s, time.Hour)
+		s.Before(func(t *testcase.T) {
+			ctx, cancel := context.WithTimeout(request.Get(t).Context(), time.Millisecond)
+			t.Defer(cancel)
+			request.Set(t, request.Get(t).WithContext(ctx))
+		})
+
+		s.Then("it is not recorded as a timeout imposed by the round tripper", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.ErrorIs(context.DeadlineExceeded, err)
+
+			t.Must.Equal(0, timeoutEvents(t))
+		})
+	})
+
+	s.When("the downstream responds in time", func(s *testcase.Spec) {
+		timeout.LetValue(s, time.Hour)
+		next.Let(s, func(t *testcase.T) http.RoundTripper {
+			return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				receivedRequests.Set(t, append(receivedRequests.Get(t), r))
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader("Hello, world!")),
+				}, nil
+			})
+		})
+
+		s.Then("the context is released only when the response body is closed", func(t *testcase.T) {
+			resp, err := act(t)
+			t.Must.Nil(err)
+			t.Must.Equal(0, timeoutEvents(t))
+
+			ctx := getLastReceivedRequest(t, receivedRequests.Get(t)).Context()
+			t.Must.Nil(ctx.Err(), "the response body should be still readable")
+			body, err := io.ReadAll(resp.Body)
+			t.Must.Nil(err)
+			t.Must.Equal("Hello, world!", string(body))
+
+			t.Must.Nil(resp.Body.Close())
+			t.Must.ErrorIs(context.Canceled, ctx.Err())
+		})
+	})
+}
+
+func TestHTTPRoundTripper_PeerServiceFn(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	peerServiceFn := testcase.LetValue[func(*http.Request) string](s, nil)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:          &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}},
+			Propagator:    propagator.Get(t),
+			Tracer:        tracer.Get(t),
+			PeerServiceFn: peerServiceFn.Get(t),
+		}.RoundTrip(request.Get(t))
+	}
+	peerService := func(t *testcase.T) (attribute.Value, bool) {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spanAttribute(spans[0], semconv.PeerServiceKey)
+	}
+
+	s.Then("the host of the request URL is recorded as peer.service by default", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		value, ok := peerService(t)
+		t.Must.True(ok)
+		t.Must.Equal(request.Get(t).URL.Hostname(), value.AsString())
+	})
+
+	s.When("peer service function is provided", func(s *testcase.Spec) {
+		name := testcase.Let(s, func(t *testcase.T) string {
+			return t.Random.StringNC(8, random.CharsetAlpha())
+		})
+		peerServiceFn.Let(s, func(t *testcase.T) func(*http.Request) string {
+			return func(r *http.Request) string {
+				t.Must.Equal(request.Get(t), r)
+				return name.Get(t)
+			}
+		})
+
+		s.Then("its result is recorded as peer.service", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			value, ok := peerService(t)
+			t.Must.True(ok)
+			t.Must.Equal(name.Get(t), value.AsString())
+		})
+	})
+}
+
+func TestHTTPRoundTripper_OperationFn(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	const operationKey = attribute.Key("otelkit.operation")
+
+	operationFn := testcase.LetValue[func(*http.Request) string](s, nil)
+	spanNameFn := testcase.LetValue[func(*http.Request) string](s, nil)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:        &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}},
+			Propagator:  propagator.Get(t),
+			Tracer:      tracer.Get(t),
+			SpanNameFn:  spanNameFn.Get(t),
+			OperationFn: operationFn.Get(t),
+		}.RoundTrip(request.Get(t))
+	}
+	onlySpan := func(t *testcase.T) traceSDK.ReadOnlySpan {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spans[0]
+	}
+
+	s.Then("no operation attribute is recorded by default", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		_, ok := spanAttribute(onlySpan(t), operationKey)
+		t.Must.False(ok)
+	})
+
+	s.When("operation function is provided", func(s *testcase.Spec) {
+		operation := testcase.Let(s, func(t *testcase.T) string {
+			return t.Random.StringNC(8, random.CharsetAlpha())
+		})
+		operationFn.Let(s, func(t *testcase.T) func(*http.Request) string {
+			return func(r *http.Request) string {
+				t.Must.Equal(request.Get(t), r)
+				return operation.Get(t)
+			}
+		})
+		spanNameFn.Let(s, func(t *testcase.T) func(*http.Request) string {
+			return func(r *http.Request) string { return r.URL.Path }
+		})
+
+		s.Then("its result is recorded as otelkit.operation, independently of the span name", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			span := onlySpan(t)
+			t.Must.Equal(request.Get(t).URL.Path, span.Name())
+			value, ok := spanAttribute(span, operationKey)
+			t.Must.True(ok)
+			t.Must.Equal(operation.Get(t), value.AsString())
+		})
+
+		s.And("it returns an empty operation name", func(s *testcase.Spec) {
+			operation.LetValue(s, "")
+
+			s.Then("no operation attribute is recorded", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.Nil(err)
+
+				_, ok := spanAttribute(onlySpan(t), operationKey)
+				t.Must.False(ok)
+			})
+		})
+	})
+}
+
+func TestHTTPRoundTripper_LinksFn(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	linksFn := testcase.LetValue[func(*http.Request) []trace.Link](s, nil)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:       &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}},
+			Propagator: propagator.Get(t),
+			Tracer:     tracer.Get(t),
+			LinksFn:    linksFn.Get(t),
+		}.RoundTrip(request.Get(t))
+	}
+	onlySpan := func(t *testcase.T) traceSDK.ReadOnlySpan {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spans[0]
+	}
+
+	s.Then("the span has no links by default", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		t.Must.Empty(onlySpan(t).Links())
+	})
+
+	s.When("links function is provided", func(s *testcase.Spec) {
+		batchSpanContext := testcase.Let(s, func(t *testcase.T) trace.SpanContext {
+			_, sc := MakeTestSpanContext(nil)
+			return sc
+		})
+		linksFn.Let(s, func(t *testcase.T) func(*http.Request) []trace.Link {
+			return func(r *http.Request) []trace.Link {
+				t.Must.Equal(request.Get(t), r)
+				return []trace.Link{{SpanContext: batchSpanContext.Get(t)}}
+			}
+		})
+
+		s.Then("the span is linked to the returned span contexts", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			links := onlySpan(t).Links()
+			t.Must.Equal(1, len(links))
+			t.Must.Equal(batchSpanContext.Get(t).TraceID(), links[0].SpanContext.TraceID())
+			t.Must.Equal(batchSpanContext.Get(t).SpanID(), links[0].SpanContext.SpanID())
+		})
+	})
+}
+
+func TestHTTPRoundTripper_PropagateBaggage(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	propagateBaggage := testcase.LetValue(s, false)
+	next := testcase.Let(s, func(t *testcase.T) *StubRoundTripper {
+		return &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}}
+	})
+	request.Let(s, func(t *testcase.T) *http.Request {
+		member, err := baggage.NewMember("tenant", "42")
+		t.Must.Nil(err)
+		ctx, err := otelkit.ContextWithBaggage(context.Background(), member)
+		t.Must.Nil(err)
+		return httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	})
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:             next.Get(t),
+			Propagator:       propagation.TraceContext{},
+			Tracer:           tracer.Get(t),
+			PropagateBaggage: propagateBaggage.Get(t),
+		}.RoundTrip(request.Get(t))
+	}
+	outboundRequest := func(t *testcase.T) *http.Request {
+		return getLastReceivedRequest(t, next.Get(t).Requests)
+	}
+
+	s.Then("the baggage is not injected by a trace context only propagator", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		t.Must.Empty(outboundRequest(t).Header.Get("baggage"))
+	})
+
+	s.When("baggage propagation is enabled", func(s *testcase.Spec) {
+		propagateBaggage.LetValue(s, true)
+
+		s.Then("the baggage of the request context is injected into the outbound request", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.NotEmpty(outboundRequest(t).Header.Get("baggage"))
+			otelkit.AssertBaggagePropagated(t, propagation.Baggage{}, outboundRequest(t), "tenant", "42")
+		})
+
+		s.Then("the trace context is still injected", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.NotEmpty(outboundRequest(t).Header.Get(traceParentHeaderKey))
+		})
+	})
+}
+
+func TestHTTPRoundTripper_Semconv(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	version := testcase.LetValue(s, otelkit.SemconvV1_7)
+	act := func(t *testcase.T) traceSDK.ReadOnlySpan {
+		_, err := otelkit.HTTPRoundTripper{
+			Next: &StubRoundTripper{Response: &http.Response{
+				StatusCode:    http.StatusTeapot,
+				ContentLength: 42,
+			}},
+			Propagator: propagator.Get(t),
+			Tracer:     tracer.Get(t),
+			Semconv:    version.Get(t),
+		}.RoundTrip(request.Get(t))
+		t.Must.Nil(err)
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spans[0]
+	}
+
+	s.Then("the v1.7.0 attribute names are recorded by default", func(t *testcase.T) {
+		span := act(t)
+
+		otelkit.AssertSpanHasAttribute(t, span, "http.method", attribute.StringValue(request.Get(t).Method))
+		otelkit.AssertSpanHasAttribute(t, span, "http.url", attribute.StringValue(request.Get(t).URL.String()))
+		otelkit.AssertSpanHasAttribute(t, span, "http.scheme", attribute.StringValue(request.Get(t).URL.Scheme))
+		otelkit.AssertSpanHasAttribute(t, span, "http.host", attribute.StringValue(request.Get(t).Host))
+		otelkit.AssertSpanHasAttribute(t, span, "http.status_code", attribute.IntValue(http.StatusTeapot))
+		otelkit.AssertSpanHasAttribute(t, span, "http.response_content_length", attribute.Int64Value(42))
+		otelkit.AssertSpanLacksAttribute(t, span, "http.request.method")
+	})
+
+	s.When("the v1.21.0 semantic conventions are selected", func(s *testcase.Spec) {
+		version.LetValue(s, otelkit.SemconvV1_21)
+
+		s.Then("the stable attribute names are recorded", func(t *testcase.T) {
+			span := act(t)
+
+			otelkit.AssertSpanHasAttribute(t, span, "http.request.method", attribute.StringValue(request.Get(t).Method))
+			otelkit.AssertSpanHasAttribute(t, span, "url.full", attribute.StringValue(request.Get(t).URL.String()))
+			otelkit.AssertSpanHasAttribute(t, span, "url.scheme", attribute.StringValue(request.Get(t).URL.Scheme))
+			otelkit.AssertSpanHasAttribute(t, span, "server.address", attribute.StringValue(request.Get(t).URL.Hostname()))
+			otelkit.AssertSpanHasAttribute(t, span, "http.response.status_code", attribute.IntValue(http.StatusTeapot))
+			otelkit.AssertSpanHasAttribute(t, span, "http.response.body.size", attribute.Int64Value(42))
+		})
+
+		s.Then("the legacy attribute names are not recorded", func(t *testcase.T) {
+			span := act(t)
+
+			for _, key := range []attribute.Key{"http.method", "http.url", "http.scheme", "http.host", "http.status_code"} {
+				otelkit.AssertSpanLacksAttribute(t, span, key)
+			}
+		})
+	})
+}
+
+func TestHTTPRoundTripper_SpanKind(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	spanKind := testcase.LetValue(s, trace.SpanKindUnspecified)
+	act := func(t *testcase.T) traceSDK.ReadOnlySpan {
+		_, err := otelkit.HTTPRoundTripper{
+			Next:       &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}},
+			Propagator: propagator.Get(t),
+			Tracer:     tracer.Get(t),
+			SpanKind:   spanKind.Get(t),
+		}.RoundTrip(request.Get(t))
+		t.Must.Nil(err)
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spans[0]
+	}
+
+	s.Then("the span is of client kind by default", func(t *testcase.T) {
+		otelkit.AssertSpanKind(t, act(t), trace.SpanKindClient)
+	})
+
+	s.When("span kind is configured", func(s *testcase.Spec) {
+		spanKind.Let(s, func(t *testcase.T) trace.SpanKind {
+			return t.Random.SliceElement([]trace.SpanKind{
+				trace.SpanKindInternal,
+				trace.SpanKindProducer,
+				trace.SpanKindServer,
+			}).(trace.SpanKind)
+		})
+
+		s.Then("the span is of the configured kind", func(t *testcase.T) {
+			otelkit.AssertSpanKind(t, act(t), spanKind.Get(t))
+		})
+	})
+}
+
+func TestNewHTTPRoundTripper(t *testing.T) {
+	t.Run("without next round tripper, the default transport is used", func(t *testing.T) {
+		r := otelkit.NewHTTPRoundTripper(nil)
+		assert.True(t, r.Next == http.DefaultTransport)
+	})
+
+	t.Run("options configure the round tripper", func(t *testing.T) {
+		exp := &otelkit.FakeSpanExporter{}
+		next := &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}}
+		r := otelkit.NewHTTPRoundTripper(next,
+			otelkit.WithTracer(NewTracerProvider(exp).Tracer("tracer")),
+			otelkit.WithPropagator(propagation.TraceContext{}),
+			otelkit.WithSpanNameFn(func(r *http.Request) string { return "custom" }),
+			otelkit.WithFilter(func(r *http.Request) bool { return r.URL.Path != "/health" }))
+
+		_, err := r.RoundTrip(httptest.NewRequest(http.MethodGet, "/foo", nil))
+		assert.NoError(t, err)
+		_, err = r.RoundTrip(httptest.NewRequest(http.MethodGet, "/health", nil))
+		assert.NoError(t, err)
+
+		spans := exp.ExportedSpans()
+		assert.Equal(t, 1, len(spans), "the filtered request is not traced")
+		assert.Equal(t, "custom", spans[0].Name())
+		assert.Equal(t, 2, len(next.Requests))
+		assert.NotEmpty(t, next.Requests[0].Header.Get(traceParentHeaderKey))
+	})
+}
+
+func TestRouteSpanNameFn(t *testing.T) {
+	spanNameFn := otelkit.RouteSpanNameFn(
+		"/users/{id}",
+		"POST /users",
+		"/orders/{id}/items",
+		"/static/{path...}",
+		"/assets/",
+		"/accounts/{$}",
+		"GET /reports/{name}",
+		"api.example.com/v1/{id}",
+	)
+	for _, tc := range []struct {
+		Method string
+		Path   string
+		Want   string
+	}{
+		{Method: http.MethodGet, Path: "/users/42", Want: "GET /users/{id}"},
+		{Method: http.MethodDelete, Path: "/users/alice", Want: "DELETE /users/{id}"},
+		{Method: http.MethodPost, Path: "/users", Want: "POST /users"},
+		{Method: http.MethodGet, Path: "/users", Want: "GET /users"},
+		{Method: http.MethodGet, Path: "/orders/7/items", Want: "GET /orders/{id}/items"},
+		{Method: http.MethodGet, Path: "/static/css/main.css", Want: "GET /static/{path...}"},
+		{Method: http.MethodGet, Path: "/users/42/avatar", Want: "GET /users/{id}/avatar"},
+		{Method: http.MethodGet, Path: "/accounts/123", Want: "GET /accounts/{id}"},
+		{Method: http.MethodGet, Path: "/static", Want: "GET /static"},
+		{Method: http.MethodGet, Path: "/assets/", Want: "GET /assets/"},
+		{Method: http.MethodGet, Path: "/assets/js/app.js", Want: "GET /assets/"},
+		{Method: http.MethodGet, Path: "/assets", Want: "GET /assets"},
+		{Method: http.MethodGet, Path: "/accounts/", Want: "GET /accounts/{$}"},
+		{Method: http.MethodHead, Path: "/reports/daily", Want: "HEAD /reports/{name}"},
+		{Method: http.MethodPost, Path: "/reports/daily", Want: "POST /reports/daily"},
+		{Method: http.MethodGet, Path: "http://api.example.com:8080/v1/7", Want: "GET api.example.com/v1/{id}"},
+		{Method: http.MethodGet, Path: "http://www.example.com/v1/7", Want: "GET /v1/{id}"},
+	} {
+		tc := tc
+		t.Run(tc.Method+" "+tc.Path, func(t *testing.T) {
+			assert.Equal(t, tc.Want, spanNameFn(httptest.NewRequest(tc.Method, tc.Path, nil)))
+		})
+	}
+
+	t.Run("as the span name function of the round tripper", func(t *testing.T) {
+		exp := &otelkit.FakeSpanExporter{}
+		_, err := otelkit.HTTPRoundTripper{
+			Next:       &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}},
+			Propagator: propagation.TraceContext{},
+			Tracer:     NewTracerProvider(exp).Tracer("tracer"),
+			SpanNameFn: spanNameFn,
+		}.RoundTrip(httptest.NewRequest(http.MethodGet, "https://example.com/users/42", nil))
+		assert.NoError(t, err)
+
+		otelkit.AssertSpanExists(t, exp, "GET /users/{id}")
+	})
+}
+
+func TestHTTPRoundTripper_ContextAttributesFn(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	type tenantIDKey struct{}
+	const tenantIDAttributeKey = attribute.Key("tenant.id")
+
+	tenantID := testcase.Let(s, func(t *testcase.T) string {
+		return t.Random.StringNC(8, random.CharsetAlpha())
+	})
+	request.Let(s, func(t *testcase.T) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		return r.WithContext(context.WithValue(r.Context(), tenantIDKey{}, tenantID.Get(t)))
+	})
+	contextAttributesFn := testcase.LetValue[func(context.Context) []attribute.KeyValue](s, nil)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:                &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}},
+			Propagator:          propagator.Get(t),
+			Tracer:              tracer.Get(t),
+			ContextAttributesFn: contextAttributesFn.Get(t),
+		}.RoundTrip(request.Get(t))
+	}
+	tenantIDAttribute := func(t *testcase.T) (attribute.Value, bool) {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spanAttribute(spans[0], tenantIDAttributeKey)
+	}
+
+	s.Then("no attribute is recorded from the context by default", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		_, ok := tenantIDAttribute(t)
+		t.Must.False(ok)
+	})
+
+	s.When("context attributes function is provided", func(s *testcase.Spec) {
+		contextAttributesFn.Let(s, func(t *testcase.T) func(context.Context) []attribute.KeyValue {
+			return func(ctx context.Context) []attribute.KeyValue {
+				id, ok := ctx.Value(tenantIDKey{}).(string)
+				if !ok {
+					return nil
+				}
+				return []attribute.KeyValue{tenantIDAttributeKey.String(id)}
+			}
+		})
+
+		s.Then("the attributes from the request context are recorded on the client span", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			value, ok := tenantIDAttribute(t)
+			t.Must.True(ok)
+			t.Must.Equal(tenantID.Get(t), value.AsString())
+		})
+
+		s.And("the request context has no such values", func(s *testcase.Spec) {
+			request.Let(s, func(t *testcase.T) *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/", nil)
+			})
+
+			s.Then("nothing is recorded", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.Nil(err)
+
+				_, ok := tenantIDAttribute(t)
+				t.Must.False(ok)
+			})
+		})
+	})
+}
+
+func TestHTTPRoundTripper_RecordSecure(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	recordSecure := testcase.LetValue(s, false)
+	target := testcase.LetValue(s, "https://example.com/")
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:         &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}},
+			Propagator:   propagator.Get(t),
+			Tracer:       tracer.Get(t),
+			RecordSecure: recordSecure.Get(t),
+		}.RoundTrip(httptest.NewRequest(http.MethodGet, target.Get(t), nil))
+	}
+	secure := func(t *testcase.T) (attribute.Value, bool) {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spanAttribute(spans[0], "http.secure")
+	}
+
+	s.Then("secure flag is not recorded by default", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		_, ok := secure(t)
+		t.Must.False(ok)
+	})
+
+	s.When("recording the secure flag is enabled", func(s *testcase.Spec) {
+		recordSecure.LetValue(s, true)
+
+		s.Then("https request is recorded as secure", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			value, ok := secure(t)
+			t.Must.True(ok)
+			t.Must.True(value.AsBool())
+		})
+
+		s.And("the request uses plain http", func(s *testcase.Spec) {
+			target.LetValue(s, "http://example.com/")
+
+			s.Then("it is recorded as insecure", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.Nil(err)
+
+				value, ok := secure(t)
+				t.Must.True(ok)
+				t.Must.False(value.AsBool())
+			})
+		})
+	})
+}
+
+func TestHTTPRoundTripper_RecordTLS(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	recordTLS := testcase.LetValue(s, true)
+	server := testcase.Let(s, func(t *testcase.T) *httptest.Server {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		t.Defer(srv.Close)
+		return srv
+	})
+	act := func(t *testcase.T) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, server.Get(t).URL, nil)
+		t.Must.Nil(err)
+		resp, err := otelkit.HTTPRoundTripper{
+			Next:       server.Get(t).Client().Transport,
+			Propagator: propagator.Get(t),
+			Tracer:     tracer.Get(t),
+			RecordTLS:  recordTLS.Get(t),
+		}.RoundTrip(req)
+		if err == nil {
+			t.Defer(resp.Body.Close)
+		}
+		return resp, err
+	}
+
+	s.Then("the negotiated TLS version and cipher suite are recorded", func(t *testcase.T) {
+		resp, err := act(t)
+		t.Must.Nil(err)
+		t.Must.NotNil(resp.TLS)
+
+		span := exportedSpan(t)
+		version, ok := spanAttribute(span, "tls.protocol.version")
+		t.Must.True(ok)
+		t.Must.Equal("1.3", version.AsString())
+		cipher, ok := spanAttribute(span, "tls.cipher")
+		t.Must.True(ok)
+		t.Must.Equal(tls.CipherSuiteName(resp.TLS.CipherSuite), cipher.AsString())
+	})
+
+	s.When("the option is disabled", func(s *testcase.Spec) {
+		recordTLS.LetValue(s, false)
+
+		s.Then("TLS is not recorded", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			_, ok := spanAttribute(exportedSpan(t), "tls.protocol.version")
+			t.Must.False(ok)
+		})
+	})
+
+	s.When("the connection is plaintext", func(s *testcase.Spec) {
+		server.Let(s, func(t *testcase.T) *httptest.Server {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			t.Defer(srv.Close)
+			return srv
+		})
+
+		s.Then("TLS is not recorded", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			span := exportedSpan(t)
+			_, ok := spanAttribute(span, "tls.protocol.version")
+			t.Must.False(ok)
+			_, ok = spanAttribute(span, "tls.cipher")
+			t.Must.False(ok)
+		})
+	})
+}
+
+func TestHTTPRoundTripper_RecordBodyProgressBytes(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	recordBodyProgressBytes := testcase.LetValue[int64](s, 0)
+	body := testcase.Let(s, func(t *testcase.T) string {
+		return t.Random.StringNC(250, random.CharsetAlpha())
+	})
+	received := testcase.LetValue[[]byte](s, nil)
+	receivedContentLength := testcase.LetValue[int64](s, 0)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next: RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				bs, err := io.ReadAll(r.Body)
+				t.Must.Nil(err)
+				t.Must.Nil(r.Body.Close())
+				received.Set(t, bs)
+				receivedContentLength.Set(t, r.ContentLength)
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			}),
+			Propagator:              propagator.Get(t),
+			Tracer:                  tracer.Get(t),
+			RecordBodyProgressBytes: recordBodyProgressBytes.Get(t),
+		}.RoundTrip(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body.Get(t))))
+	}
+	progressEvents := func(t *testcase.T) []int64 {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		var milestones []int64
+		for _, event := range spans[0].Events() {
+			if event.Name != "otelkit.request.body.progress" {
+				continue
+			}
+			for _, kv := range event.Attributes {
+				if kv.Key == "otelkit.request.body.bytes_read" {
+					milestones = append(milestones, kv.Value.AsInt64())
+				}
+			}
+		}
+		return milestones
+	}
+
+	s.Then("no progress event is recorded by default", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		t.Must.Empty(progressEvents(t))
+		t.Must.Equal(body.Get(t), string(received.Get(t)))
+	})
+
+	s.When("progress is recorded every N bytes", func(s *testcase.Spec) {
+		recordBodyProgressBytes.LetValue(s, 100)
+
+		s.Then("an event is recorded at each milestone", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.Equal([]int64{100, 200}, progressEvents(t))
+		})
+
+		s.Then("the body and its content length are forwarded intact", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.Equal(body.Get(t), string(received.Get(t)))
+			t.Must.Equal(int64(len(body.Get(t))), receivedContentLength.Get(t))
+		})
+	})
+}
+
+func TestHTTPMiddlewareTracing_UsePattern_withoutPattern(t *testing.T) {
+	for path, want := range map[string]string{
+		"/users/42": "/users/{id}",
+		"/orders/3f2a9c1e-7b4d-4e8a-9c0f-1a2b3c4d5e6f": "/orders/{id}",
+		"/blobs/deadbeefcafebabe0123/raw":              "/blobs/{id}/raw",
+		"/health":                                      "/health",
+		"/cafe":                                        "/cafe",
+	} {
+		exp := &otelkit.FakeSpanExporter{}
+		otelkit.HTTPMiddlewareTracing{
+			Next:       http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+			Tracer:     NewTracerProvider(exp).Tracer("tracer"),
+			UsePattern: true,
+		}.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+
+		spans := exp.ExportedSpans()
+		assert.Equal(t, 1, len(spans))
+		assert.Equal(t, want, spans[0].Name(), path)
+		_, ok := spanAttribute(spans[0], semconv.HTTPRouteKey)
+		assert.False(t, ok, "sanitized path is not a route")
+	}
+}
+
+func TestHTTPRoundTripper_SpanNameWithDefaultFn(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	var (
+		spanNameFn            = testcase.LetValue[func(*http.Request) string](s, nil)
+		spanNameWithDefaultFn = testcase.LetValue[func(*http.Request, string) string](s, nil)
+	)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:                  &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}},
+			Propagator:            propagator.Get(t),
+			Tracer:                tracer.Get(t),
+			SpanNameFn:            spanNameFn.Get(t),
+			SpanNameWithDefaultFn: spanNameWithDefaultFn.Get(t),
+		}.RoundTrip(request.Get(t))
+	}
+	spanName := func(t *testcase.T) string {
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spans[0].Name()
+	}
+
+	s.Then("the default span name is used without naming functions", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		t.Must.Equal("http-request", spanName(t))
+	})
+
+	s.When("the naming function with the default name is provided", func(s *testcase.Spec) {
+		spanNameWithDefaultFn.Let(s, func(t *testcase.T) func(*http.Request, string) string {
+			return func(r *http.Request, defaultName string) string {
+				t.Must.Equal(request.Get(t), r)
+				return r.Method + " " + defaultName
+			}
+		})
+
+		s.Then("it can extend the default span name", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.Equal(request.Get(t).Method+" http-request", spanName(t))
+		})
+
+		s.And("span name function is provided as well", func(s *testcase.Spec) {
+			spanNameFn.Let(s, func(t *testcase.T) func(*http.Request) string {
+				return func(r *http.Request) string { return "custom" }
+			})
+
+			s.Then("span name function takes precedence", func(t *testcase.T) {
+				_, err := act(t)
+				t.Must.Nil(err)
+
+				t.Must.Equal("custom", spanName(t))
+			})
+		})
+	})
+}
+
+func TestHTTPMiddlewareTracing_recordOnlySampler(t *testing.T) {
+	processor := &endedSpanProcessor{}
+	tp := traceSDK.NewTracerProvider(traceSDK.WithSampler(recordOnlySampler{}), traceSDK.WithSpanProcessor(processor))
+	otelkit.HTTPMiddlewareTracing{
+		Next:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		Tracer: tp.Tracer("tracer"),
+	}.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, 1, len(processor.spans))
+	otelkit.AssertSpanHasAttribute(t, processor.spans[0], "otelkit.sampling.sampled", attribute.BoolValue(false))
+}
+
+// recordOnlySampler keeps every span recording without sampling it.
+type recordOnlySampler struct{}
+
+func (recordOnlySampler) ShouldSample(p traceSDK.SamplingParameters) traceSDK.SamplingResult {
+	return traceSDK.SamplingResult{
+		Decision:   traceSDK.RecordOnly,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (recordOnlySampler) Description() string { return "RecordOnly" }
+
+// endedSpanProcessor captures the ended spans, including the ones that are not sampled and therefore not exported.
+type endedSpanProcessor struct{ spans []traceSDK.ReadOnlySpan }
+
+func (p *endedSpanProcessor) OnStart(context.Context, traceSDK.ReadWriteSpan) {}
+
+func (p *endedSpanProcessor) OnEnd(s traceSDK.ReadOnlySpan) { p.spans = append(p.spans, s) }
+
+func (p *endedSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (p *endedSpanProcessor) ForceFlush(context.Context) error { return nil }
+
+func TestHTTPMiddlewareTracing_globalTracerVersion(t *testing.T) {
+	stub := otelkit.Stub(t)
+
+	otelkit.HTTPMiddlewareTracing{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	}.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	spans := stub.SpanExporter.ExportedSpans()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, "github.com/adamluzsi/otelkit", spans[0].InstrumentationScope().Name)
+	assert.Equal(t, otelkit.Version, spans[0].InstrumentationScope().Version)
+}
+
+func TestHTTPRoundTripper_globalFallback(t *testing.T) {
+	stub := otelkit.Stub(t)
+	ogPropagator := otel.GetTextMapPropagator()
+	t.Cleanup(func() { otel.SetTextMapPropagator(ogPropagator) })
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var received *http.Request
+	client := &http.Client{Transport: otelkit.HTTPRoundTripper{
+		Next: RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			received = r
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+	}}
+	resp, err := client.Get("http://example.com/")
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	spans := stub.SpanExporter.ExportedSpans()
+	assert.Equal(t, 1, len(spans), "the span is recorded with the global tracer provider")
+	assert.Equal(t, "github.com/adamluzsi/otelkit", spans[0].InstrumentationScope().Name)
+
+	assert.NotNil(t, received)
+	sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(received.Header)))
+	assert.True(t, sc.IsValid(), "the tracing is injected with the global propagator")
+	assert.Equal(t, spans[0].SpanContext().SpanID(), sc.SpanID())
+}
+
+func TestHTTPRoundTripper_Filter(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	filter := testcase.LetValue[func(*http.Request) bool](s, nil)
+	nextRoundTripper := testcase.Let(s, func(t *testcase.T) *StubRoundTripper {
+		return &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusOK}}
+	})
+	GivenRequestContextHasTracing(s)
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPRoundTripper{
+			Next:       nextRoundTripper.Get(t),
+			Propagator: propagator.Get(t),
+			Tracer:     tracer.Get(t),
+			Filter:     filter.Get(t),
+		}.RoundTrip(request.Get(t))
+	}
+
+	s.Then("requests are traced by default", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		t.Must.Equal(1, len(stubSpanExporter.Get(t).ExportedSpans()))
+		receivedRequest := getLastReceivedRequest(t, nextRoundTripper.Get(t).Requests)
+		t.Must.NotEmpty(receivedRequest.Header.Get(traceParentHeaderKey))
+	})
+
+	s.When("the filter rejects the request", func(s *testcase.Spec) {
+		filter.Let(s, func(t *testcase.T) func(*http.Request) bool {
+			return func(r *http.Request) bool {
+				t.Must.Equal(request.Get(t), r)
+				return false
+			}
+		})
+
+		s.Then("the request is passed to the next round tripper without tracing", func(t *testcase.T) {
+			resp, err := act(t)
+			t.Must.Nil(err)
+			t.Must.Equal(http.StatusOK, resp.StatusCode)
+
+			t.Must.Empty(stubSpanExporter.Get(t).ExportedSpans())
+			receivedRequest := getLastReceivedRequest(t, nextRoundTripper.Get(t).Requests)
+			t.Must.Equal(request.Get(t), receivedRequest)
+			t.Must.Empty(receivedRequest.Header.Get(traceParentHeaderKey))
+		})
+	})
+
+	s.When("the filter accepts the request", func(s *testcase.Spec) {
+		filter.Let(s, func(t *testcase.T) func(*http.Request) bool {
+			return func(r *http.Request) bool { return true }
+		})
+
+		s.Then("the request is traced", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.Nil(err)
+
+			t.Must.Equal(1, len(stubSpanExporter.Get(t).ExportedSpans()))
+		})
+	})
+}
+
+func TestHTTPMiddlewareResponseStatus_ServeHTTP(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	makeSubject := func(t *testcase.T, next http.Handler) http.Handler {
+		return otelkit.HTTPMiddlewareResponseStatus{Next: next}
+	}
+	next := testcase.Let[http.Handler](s, func(t *testcase.T) http.Handler {
+		return stubHandler.Get(t)
+	})
+	act := func(t *testcase.T) traceSDK.ReadOnlySpan {
+		ctx, span := tracer.Get(t).Start(context.Background(), "server")
+		r := request.Get(t).WithContext(ctx)
+		makeSubject(t, next.Get(t)).ServeHTTP(responseRecorder.Get(t), r)
+		span.End()
+
+		spans := stubSpanExporter.Get(t).ExportedSpans()
+		t.Must.Equal(1, len(spans))
+		return spans[0]
+	}
+	statusCode := func(t *testcase.T, span traceSDK.ReadOnlySpan) int64 {
+		value, ok := spanAttribute(span, semconv.HTTPStatusCodeKey)
+		t.Must.True(ok)
+		return value.AsInt64()
+	}
+
+	ItBehavesLikeAMiddleware(s, makeSubject)
+
+	s.Then("the written status code is recorded on the span of the request context", func(t *testcase.T) {
+		span := act(t)
+
+		t.Must.Equal(int64(stubHandler.Get(t).ExpectedResponseCode), statusCode(t, span))
+	})
+
+	s.When("the next handler never writes the header", func(s *testcase.Spec) {
+		next.Let(s, func(t *testcase.T) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		})
+
+		s.Then("200 is recorded", func(t *testcase.T) {
+			t.Must.Equal(int64(http.StatusOK), statusCode(t, act(t)))
+		})
+	})
+
+	s.When("the next handler flushes", func(s *testcase.Spec) {
+		next.Let(s, func(t *testcase.T) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				f, ok := w.(http.Flusher)
+				t.Must.True(ok, "the response writer should implement http.Flusher")
+				f.Flush()
+			})
+		})
+
+		s.Then("the flush is passed through", func(t *testcase.T) {
+			act(t)
+
+			t.Must.True(responseRecorder.Get(t).Flushed)
+		})
+	})
+
+	s.When("the next handler hijacks a response writer that doesn't support it", func(s *testcase.Spec) {
+		hijackErr := testcase.LetValue[error](s, nil)
+		next.Let(s, func(t *testcase.T) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				h, ok := w.(http.Hijacker)
+				t.Must.True(ok, "the response writer should implement http.Hijacker")
+				_, _, err := h.Hijack()
+				hijackErr.Set(t, err)
+			})
+		})
+
+		s.Then("an error is returned", func(t *testcase.T) {
+			act(t)
+
+			t.Must.NotNil(hijackErr.Get(t))
+		})
+	})
+}
+
+func TestHTTPMiddlewareTracing_Semconv(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	otelkit.HTTPMiddlewareTracing{
+		Next: otelkit.HTTPMiddlewareResponseStatus{
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			}),
+			Semconv: otelkit.SemconvV1_21,
+		},
+		Tracer:  NewTracerProvider(exp).Tracer("tracer"),
+		RouteFn: func(r *http.Request) string { return "/users/{id}" },
+		Semconv: otelkit.SemconvV1_21,
+	}.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42?q=1", nil))
+
+	spans := exp.ExportedSpans()
+	assert.Equal(t, 1, len(spans))
+	otelkit.AssertSpanHasAttribute(t, spans[0], "http.request.method", attribute.StringValue(http.MethodGet))
+	otelkit.AssertSpanHasAttribute(t, spans[0], "url.path", attribute.StringValue("/users/42"))
+	otelkit.AssertSpanHasAttribute(t, spans[0], "url.scheme", attribute.StringValue("http"))
+	otelkit.AssertSpanHasAttribute(t, spans[0], "server.address", attribute.StringValue("example.com"))
+	otelkit.AssertSpanHasAttribute(t, spans[0], "client.address", attribute.StringValue("192.0.2.1"))
+	otelkit.AssertSpanHasAttribute(t, spans[0], "http.route", attribute.StringValue("/users/{id}"))
+	otelkit.AssertSpanHasAttribute(t, spans[0], "http.response.status_code", attribute.IntValue(http.StatusTeapot))
+	for _, key := range []attribute.Key{"http.method", "http.target", "http.scheme", "http.host", "http.status_code"} {
+		otelkit.AssertSpanLacksAttribute(t, spans[0], key)
+	}
+}
+
+func TestHTTPMiddlewareResponseStatus_hijack(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	handler := otelkit.HTTPMiddlewareTracing{
+		Tracer: NewTracerProvider(exp).Tracer("tracer"),
+		Next: otelkit.HTTPMiddlewareResponseStatus{
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, buf, err := w.(http.Hijacker).Hijack()
+				assert.NoError(t, err)
+				defer conn.Close()
+				_, _ = buf.WriteString("HTTP/1.1 418 I'm a teapot\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+				_ = buf.Flush()
+			}),
+		},
+	}
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+
+	<-done
+	span := otelkit.AssertSpanExists(t, exp, "http-server-request")
+	otelkit.AssertSpanLacksAttribute(t, span, semconv.HTTPStatusCodeKey)
+}
@@ -0,0 +1,152 @@
+package otelkit
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"net/http"
+	"time"
+)
+
+// HTTPMiddlewareMetrics records the duration of the inbound requests as the http.server.duration histogram (in milliseconds),
+// and the number of in-flight requests as the http.server.active_requests up-down counter.
+// Measurements are labeled with the method, the route when RouteFn is provided, and the duration with the response status code too.
+//
+// When Meter is nil, the global MeterProvider from the otel package is used.
+type HTTPMiddlewareMetrics struct {
+	Next    http.Handler
+	Meter   metric.Meter
+	RouteFn func(r *http.Request) string
+	// Semconv selects the semantic conventions of the measurements' attributes.
+	// By default, it's SemconvV1_7.
+	Semconv SemconvVersion
+}
+
+const (
+	httpServerDurationMetricName       = "http.server.duration"
+	httpServerActiveRequestsMetricName = "http.server.active_requests"
+)
+
+func (mw HTTPMiddlewareMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	duration, activeRequests, err := mw.instruments()
+	if err != nil {
+		otel.Handle(err)
+		mw.Next.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	httpAttrs := httpAttributes{version: mw.Semconv}
+	attrs := []attribute.KeyValue{httpAttrs.method(r.Method)}
+	if mw.RouteFn != nil {
+		if route := mw.RouteFn(r); route != "" {
+			attrs = append(attrs, httpAttrs.route(route))
+		}
+	}
+
+	activeRequests.Add(ctx, 1, metric.WithAttributes(attrs...))
+	defer activeRequests.Add(ctx, -1, metric.WithAttributes(attrs...))
+
+	rec := &statusRecorder{ResponseWriter: w}
+	start := time.Now()
+	var completed bool
+	defer func() {
+		code := rec.Status()
+		if !completed && rec.status == 0 {
+			// The Next handler panicked before writing the header, which a recovery middleware answers with 500.
+			code = http.StatusInternalServerError
+		}
+		attrs := append(attrs, httpAttrs.statusCode(code))
+		duration.Record(ctx, durationInMilliseconds(time.Since(start)), metric.WithAttributes(attrs...))
+	}()
+
+	mw.Next.ServeHTTP(rec, r)
+	completed = true
+}
+
+func (mw HTTPMiddlewareMetrics) instruments() (metric.Float64Histogram, metric.Int64UpDownCounter, error) {
+	meter := mw.Meter
+	if meter == nil {
+		meter = otel.GetMeterProvider().Meter(instrumentationName, metric.WithInstrumentationVersion(Version))
+	}
+	duration, err := meter.Float64Histogram(httpServerDurationMetricName,
+		metric.WithUnit("ms"),
+		metric.WithDescription("The duration of the inbound HTTP requests."))
+	if err != nil {
+		return nil, nil, err
+	}
+	activeRequests, err := meter.Int64UpDownCounter(httpServerActiveRequestsMetricName,
+		metric.WithUnit("{request}"),
+		metric.WithDescription("The number of concurrent inbound HTTP requests in flight."))
+	if err != nil {
+		return nil, nil, err
+	}
+	return duration, activeRequests, nil
+}
+
+func durationInMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// HTTPMetricsRoundTripper records the duration of the outbound requests as the http.client.duration histogram (in milliseconds),
+// and their number as the http.client.request.count counter.
+// Measurements are labeled with the method, the host and, when a response is received, the response status code.
+//
+// When Meter is nil, the global MeterProvider from the otel package is used.
+type HTTPMetricsRoundTripper struct {
+	Next  http.RoundTripper
+	Meter metric.Meter
+	// Semconv selects the semantic conventions of the measurements' attributes.
+	// By default, it's SemconvV1_7.
+	Semconv SemconvVersion
+}
+
+const (
+	httpClientDurationMetricName     = "http.client.duration"
+	httpClientRequestCountMetricName = "http.client.request.count"
+)
+
+func (r HTTPMetricsRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	duration, requestCount, err := r.instruments()
+	if err != nil {
+		otel.Handle(err)
+		return r.Next.RoundTrip(request)
+	}
+
+	start := time.Now()
+	response, err := r.Next.RoundTrip(request)
+	elapsed := time.Since(start)
+
+	httpAttrs := httpAttributes{version: r.Semconv}
+	attrs := []attribute.KeyValue{
+		httpAttrs.method(request.Method),
+		httpAttrs.host(request.URL),
+	}
+	if err == nil {
+		attrs = append(attrs, httpAttrs.statusCode(response.StatusCode))
+	}
+	ctx := request.Context()
+	duration.Record(ctx, durationInMilliseconds(elapsed), metric.WithAttributes(attrs...))
+	requestCount.Add(ctx, 1, metric.WithAttributes(attrs...))
+	return response, err
+}
+
+func (r HTTPMetricsRoundTripper) instruments() (metric.Float64Histogram, metric.Int64Counter, error) {
+	meter := r.Meter
+	if meter == nil {
+		meter = otel.GetMeterProvider().Meter(instrumentationName, metric.WithInstrumentationVersion(Version))
+	}
+	duration, err := meter.Float64Histogram(httpClientDurationMetricName,
+		metric.WithUnit("ms"),
+		metric.WithDescription("The duration of the outbound HTTP requests."))
+	if err != nil {
+		return nil, nil, err
+	}
+	requestCount, err := meter.Int64Counter(httpClientRequestCountMetricName,
+		metric.WithUnit("{request}"),
+		metric.WithDescription("The number of outbound HTTP requests."))
+	if err != nil {
+		return nil, nil, err
+	}
+	return duration, requestCount, nil
+}
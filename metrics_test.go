@@ -0,0 +1,344 @@
+package otelkit_test
+
+import (
+	"context"
+	"errors"
+	"github.com/adamluzsi/otelkit"
+	"github.com/adamluzsi/testcase"
+	"go.opentelemetry.io/otel/attribute"
+	metricSDK "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"net/http"
+	"testing"
+)
+
+var metricReader = testcase.Var[metricSDK.Reader]{
+	ID: "metric reader",
+	Init: func(t *testcase.T) metricSDK.Reader {
+		return metricSDK.NewManualReader()
+	},
+}
+
+var meterProvider = testcase.Var[*metricSDK.MeterProvider]{
+	ID: "meter provider",
+	Init: func(t *testcase.T) *metricSDK.MeterProvider {
+		return metricSDK.NewMeterProvider(metricSDK.WithReader(metricReader.Get(t)))
+	},
+}
+
+func collectMetric(t *testcase.T, name string) metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	t.Must.Nil(metricReader.Get(t).Collect(context.Background(), &rm))
+	var names []string
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m
+			}
+			names = append(names, m.Name)
+		}
+	}
+	t.Fatalf("metric %q not found, available metrics: %v", name, names)
+	return metricdata.Metrics{}
+}
+
+func TestHTTPMiddlewareMetrics_ServeHTTP(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	var (
+		routeFn        = testcase.LetValue[func(*http.Request) string](s, nil)
+		activeRequests = testcase.LetValue[[]int64](s, nil)
+	)
+	makeSubject := func(t *testcase.T, next http.Handler) http.Handler {
+		return otelkit.HTTPMiddlewareMetrics{
+			Next:    next,
+			Meter:   meterProvider.Get(t).Meter("test"),
+			RouteFn: routeFn.Get(t),
+		}
+	}
+	act := func(t *testcase.T) {
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sum := collectMetric(t, "http.server.active_requests").Data.(metricdata.Sum[int64])
+			activeRequests.Set(t, append(activeRequests.Get(t), sum.DataPoints[0].Value))
+			stubHandler.Get(t).ServeHTTP(w, r)
+		})
+		makeSubject(t, next).ServeHTTP(responseRecorder.Get(t), request.Get(t))
+	}
+
+	ItBehavesLikeAMiddleware(s, makeSubject)
+
+	s.Then("it records the request duration with the method and status code", func(t *testcase.T) {
+		act(t)
+
+		histogram := collectMetric(t, "http.server.duration").Data.(metricdata.Histogram[float64])
+		t.Must.Equal(1, len(histogram.DataPoints))
+		dp := histogram.DataPoints[0]
+		t.Must.Equal(uint64(1), dp.Count)
+		t.Must.Equal(attribute.NewSet(
+			semconv.HTTPMethodKey.String(request.Get(t).Method),
+			semconv.HTTPStatusCodeKey.Int(stubHandler.Get(t).ExpectedResponseCode),
+		), dp.Attributes)
+	})
+
+	s.Then("the request is counted as active while it is served", func(t *testcase.T) {
+		act(t)
+
+		t.Must.Equal([]int64{1}, activeRequests.Get(t))
+		sum := collectMetric(t, "http.server.active_requests").Data.(metricdata.Sum[int64])
+		t.Must.Equal(int64(0), sum.DataPoints[0].Value)
+	})
+
+	s.When("route resolver is provided", func(s *testcase.Spec) {
+		routeFn.Let(s, func(t *testcase.T) func(*http.Request) string {
+			return func(*http.Request) string { return "/resources/{id}" }
+		})
+
+		s.Then("the measurements are labeled with the route", func(t *testcase.T) {
+			act(t)
+
+			histogram := collectMetric(t, "http.server.duration").Data.(metricdata.Histogram[float64])
+			value, ok := histogram.DataPoints[0].Attributes.Value(semconv.HTTPRouteKey)
+			t.Must.True(ok)
+			t.Must.Equal("/resources/{id}", value.AsString())
+		})
+	})
+
+	s.When("the next handler never calls WriteHeader", func(s *testcase.Spec) {
+		s.Then("status code defaults to 200 OK", func(t *testcase.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("OK"))
+			})
+			makeSubject(t, next).ServeHTTP(responseRecorder.Get(t), request.Get(t))
+
+			histogram := collectMetric(t, "http.server.duration").Data.(metricdata.Histogram[float64])
+			value, ok := histogram.DataPoints[0].Attributes.Value(semconv.HTTPStatusCodeKey)
+			t.Must.True(ok)
+			t.Must.Equal(int64(http.StatusOK), value.AsInt64())
+		})
+	})
+
+	s.When("the next handler panics before writing the header", func(s *testcase.Spec) {
+		s.Then("the duration is recorded with 500 Internal Server Error", func(t *testcase.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+			func() {
+				defer func() { t.Must.NotNil(recover()) }()
+				makeSubject(t, next).ServeHTTP(responseRecorder.Get(t), request.Get(t))
+			}()
+
+			histogram := collectMetric(t, "http.server.duration").Data.(metricdata.Histogram[float64])
+			value, ok := histogram.DataPoints[0].Attributes.Value(semconv.HTTPStatusCodeKey)
+			t.Must.True(ok)
+			t.Must.Equal(int64(http.StatusInternalServerError), value.AsInt64())
+		})
+	})
+}
+
+func TestHTTPMiddlewareNoTracingWarning_Meter(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	routeFn := testcase.LetValue[func(*http.Request) string](s, nil)
+	makeSubject := func(t *testcase.T, next http.Handler) http.Handler {
+		return otelkit.HTTPMiddlewareNoTracingWarning{
+			Next:       next,
+			Propagator: propagator.Get(t),
+			Meter:      meterProvider.Get(t).Meter("test"),
+			RouteFn:    routeFn.Get(t),
+		}
+	}
+	act := func(t *testcase.T) {
+		makeSubject(t, stubHandler.Get(t)).ServeHTTP(responseRecorder.Get(t), request.Get(t))
+	}
+
+	ItBehavesLikeAMiddleware(s, makeSubject)
+
+	s.Then("the request without tracing is counted with its method", func(t *testcase.T) {
+		act(t)
+		act(t)
+
+		sum := collectMetric(t, "otelkit.http.missing_trace").Data.(metricdata.Sum[int64])
+		t.Must.Equal(1, len(sum.DataPoints))
+		t.Must.Equal(int64(2), sum.DataPoints[0].Value)
+		method, ok := sum.DataPoints[0].Attributes.Value(semconv.HTTPMethodKey)
+		t.Must.True(ok)
+		t.Must.Equal(request.Get(t).Method, method.AsString())
+	})
+
+	s.When("route function is provided", func(s *testcase.Spec) {
+		routeFn.Let(s, func(t *testcase.T) func(*http.Request) string {
+			return func(r *http.Request) string { return "/users/{id}" }
+		})
+
+		s.Then("the count is labeled with the route", func(t *testcase.T) {
+			act(t)
+
+			sum := collectMetric(t, "otelkit.http.missing_trace").Data.(metricdata.Sum[int64])
+			t.Must.Equal(1, len(sum.DataPoints))
+			route, ok := sum.DataPoints[0].Attributes.Value(semconv.HTTPRouteKey)
+			t.Must.True(ok)
+			t.Must.Equal("/users/{id}", route.AsString())
+		})
+	})
+
+	s.When("the request has tracing, but misses a required header", func(s *testcase.Spec) {
+		GivenRequestHeaderHasTracing(s)
+
+		s.Then("it's not counted as a request without tracing", func(t *testcase.T) {
+			otelkit.HTTPMiddlewareNoTracingWarning{
+				Next:            stubHandler.Get(t),
+				Propagator:      propagator.Get(t),
+				Meter:           meterProvider.Get(t).Meter("test"),
+				RequiredHeaders: []string{"X-Request-Id"},
+				NotifyFn:        func(otelkit.NoTracingWarningEvent) {},
+			}.ServeHTTP(responseRecorder.Get(t), request.Get(t))
+
+			var rm metricdata.ResourceMetrics
+			t.Must.Nil(metricReader.Get(t).Collect(context.Background(), &rm))
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					t.Must.NotEqual("otelkit.http.missing_trace", m.Name)
+				}
+			}
+		})
+	})
+
+	s.When("the request has tracing", func(s *testcase.Spec) {
+		GivenRequestHeaderHasTracing(s)
+
+		s.Then("nothing is counted", func(t *testcase.T) {
+			act(t)
+
+			var rm metricdata.ResourceMetrics
+			t.Must.Nil(metricReader.Get(t).Collect(context.Background(), &rm))
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					t.Must.NotEqual("otelkit.http.missing_trace", m.Name)
+				}
+			}
+		})
+	})
+}
+
+func TestHTTPMetricsRoundTripper_RoundTrip(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	next := testcase.Let(s, func(t *testcase.T) *StubRoundTripper {
+		return &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusTeapot}}
+	})
+	act := func(t *testcase.T) (*http.Response, error) {
+		return otelkit.HTTPMetricsRoundTripper{
+			Next:  next.Get(t),
+			Meter: meterProvider.Get(t).Meter("test"),
+		}.RoundTrip(request.Get(t))
+	}
+
+	s.Then("the response of the next round tripper is returned", func(t *testcase.T) {
+		response, err := act(t)
+		t.Must.Nil(err)
+		t.Must.Equal(http.StatusTeapot, response.StatusCode)
+	})
+
+	s.Then("the request is counted with its method, host and status code", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		sum := collectMetric(t, "http.client.request.count").Data.(metricdata.Sum[int64])
+		t.Must.Equal(1, len(sum.DataPoints))
+		t.Must.Equal(int64(1), sum.DataPoints[0].Value)
+		attrs := sum.DataPoints[0].Attributes
+		t.Must.True(attrs.HasValue(semconv.HTTPMethodKey))
+		host, ok := attrs.Value(semconv.HTTPHostKey)
+		t.Must.True(ok)
+		t.Must.Equal(request.Get(t).URL.Host, host.AsString())
+		status, ok := attrs.Value(semconv.HTTPStatusCodeKey)
+		t.Must.True(ok)
+		t.Must.Equal(int64(http.StatusTeapot), status.AsInt64())
+	})
+
+	s.Then("the duration of the request is recorded", func(t *testcase.T) {
+		_, err := act(t)
+		t.Must.Nil(err)
+
+		histogram := collectMetric(t, "http.client.duration").Data.(metricdata.Histogram[float64])
+		t.Must.Equal(1, len(histogram.DataPoints))
+		t.Must.Equal(uint64(1), histogram.DataPoints[0].Count)
+	})
+
+	s.When("the next round tripper fails", func(s *testcase.Spec) {
+		next.Let(s, func(t *testcase.T) *StubRoundTripper {
+			return &StubRoundTripper{Err: errors.New("boom")}
+		})
+
+		s.Then("the request is still counted, but without a status code", func(t *testcase.T) {
+			_, err := act(t)
+			t.Must.NotNil(err)
+
+			sum := collectMetric(t, "http.client.request.count").Data.(metricdata.Sum[int64])
+			t.Must.Equal(1, len(sum.DataPoints))
+			t.Must.False(sum.DataPoints[0].Attributes.HasValue(semconv.HTTPStatusCodeKey))
+		})
+	})
+}
+
+func TestHTTPMetrics_Semconv(t *testing.T) {
+	s := testcase.NewSpec(t)
+	s.NoSideEffect()
+
+	assertStableNames := func(t *testcase.T, attrs attribute.Set, stable, legacy []attribute.Key) {
+		for _, key := range stable {
+			t.Must.True(attrs.HasValue(key), string(key))
+		}
+		for _, key := range legacy {
+			t.Must.False(attrs.HasValue(key), string(key))
+		}
+	}
+
+	s.Test("HTTPMiddlewareMetrics", func(t *testcase.T) {
+		otelkit.HTTPMiddlewareMetrics{
+			Next:    stubHandler.Get(t),
+			Meter:   meterProvider.Get(t).Meter("test"),
+			RouteFn: func(r *http.Request) string { return "/users/{id}" },
+			Semconv: otelkit.SemconvV1_21,
+		}.ServeHTTP(responseRecorder.Get(t), request.Get(t))
+
+		histogram := collectMetric(t, "http.server.duration").Data.(metricdata.Histogram[float64])
+		t.Must.Equal(1, len(histogram.DataPoints))
+		assertStableNames(t, histogram.DataPoints[0].Attributes,
+			[]attribute.Key{"http.request.method", "http.route", "http.response.status_code"},
+			[]attribute.Key{semconv.HTTPMethodKey, semconv.HTTPStatusCodeKey})
+	})
+
+	s.Test("HTTPMetricsRoundTripper", func(t *testcase.T) {
+		_, err := otelkit.HTTPMetricsRoundTripper{
+			Next:    &StubRoundTripper{Response: &http.Response{StatusCode: http.StatusTeapot}},
+			Meter:   meterProvider.Get(t).Meter("test"),
+			Semconv: otelkit.SemconvV1_21,
+		}.RoundTrip(request.Get(t))
+		t.Must.Nil(err)
+
+		sum := collectMetric(t, "http.client.request.count").Data.(metricdata.Sum[int64])
+		t.Must.Equal(1, len(sum.DataPoints))
+		assertStableNames(t, sum.DataPoints[0].Attributes,
+			[]attribute.Key{"http.request.method", "server.address", "http.response.status_code"},
+			[]attribute.Key{semconv.HTTPMethodKey, semconv.HTTPHostKey, semconv.HTTPStatusCodeKey})
+	})
+
+	s.Test("HTTPMiddlewareNoTracingWarning", func(t *testcase.T) {
+		otelkit.HTTPMiddlewareNoTracingWarning{
+			Next:     stubHandler.Get(t),
+			Meter:    meterProvider.Get(t).Meter("test"),
+			NotifyFn: func(otelkit.NoTracingWarningEvent) {},
+			Semconv:  otelkit.SemconvV1_21,
+		}.ServeHTTP(responseRecorder.Get(t), request.Get(t))
+
+		sum := collectMetric(t, "otelkit.http.missing_trace").Data.(metricdata.Sum[int64])
+		t.Must.Equal(1, len(sum.DataPoints))
+		assertStableNames(t, sum.DataPoints[0].Attributes,
+			[]attribute.Key{"http.request.method"},
+			[]attribute.Key{semconv.HTTPMethodKey})
+	})
+}
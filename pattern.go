@@ -0,0 +1,7 @@
+//go:build go1.22
+
+package otelkit
+
+import "net/http"
+
+func requestPattern(r *http.Request) string { return r.Pattern }
@@ -0,0 +1,8 @@
+//go:build !go1.22
+
+package otelkit
+
+import "net/http"
+
+// requestPattern has nothing to return before Go 1.22, as http.Request has no Pattern field.
+func requestPattern(r *http.Request) string { return "" }
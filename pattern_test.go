@@ -0,0 +1,96 @@
+//go:build go1.22
+
+// The module's go version makes the ServeMux default to its pre Go 1.22 behaviour, without patterns.
+//go:debug httpmuxgo121=0
+
+package otelkit_test
+
+import (
+	"github.com/adamluzsi/otelkit"
+	"github.com/adamluzsi/testcase/assert"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPMiddlewareTracing_UsePattern(t *testing.T) {
+	newMux := func(wrap func(http.Handler) http.Handler) *http.ServeMux {
+		mux := http.NewServeMux()
+		mux.Handle("GET /users/{id}", wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+		return mux
+	}
+
+	t.Run("middleware inside the ServeMux", func(t *testing.T) {
+		exp := &otelkit.FakeSpanExporter{}
+		mux := newMux(func(next http.Handler) http.Handler {
+			return otelkit.HTTPMiddlewareTracing{Next: next, Tracer: NewTracerProvider(exp).Tracer("tracer"), UsePattern: true}
+		})
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+		spans := exp.ExportedSpans()
+		assert.Equal(t, 1, len(spans))
+		assert.Equal(t, "GET /users/{id}", spans[0].Name())
+		route, ok := spanAttribute(spans[0], semconv.HTTPRouteKey)
+		assert.True(t, ok)
+		assert.Equal(t, "/users/{id}", route.AsString())
+	})
+
+	t.Run("middleware wrapping the ServeMux", func(t *testing.T) {
+		exp := &otelkit.FakeSpanExporter{}
+		handler := otelkit.HTTPMiddlewareTracing{
+			Next:       newMux(func(next http.Handler) http.Handler { return next }),
+			Tracer:     NewTracerProvider(exp).Tracer("tracer"),
+			UsePattern: true,
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+		spans := exp.ExportedSpans()
+		assert.Equal(t, 1, len(spans))
+		assert.Equal(t, "GET /users/{id}", spans[0].Name())
+		route, ok := spanAttribute(spans[0], semconv.HTTPRouteKey)
+		assert.True(t, ok)
+		assert.Equal(t, "/users/{id}", route.AsString())
+	})
+
+	t.Run("the route is the path template of a pattern with a host", func(t *testing.T) {
+		exp := &otelkit.FakeSpanExporter{}
+		mux := http.NewServeMux()
+		mux.Handle("GET example.com/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		handler := otelkit.HTTPMiddlewareTracing{
+			Next:       mux,
+			Tracer:     NewTracerProvider(exp).Tracer("tracer"),
+			UsePattern: true,
+			Semconv:    otelkit.SemconvV1_21,
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/users/42", nil))
+
+		spans := exp.ExportedSpans()
+		assert.Equal(t, 1, len(spans))
+		assert.Equal(t, "GET example.com/users/{id}", spans[0].Name())
+		route, ok := spanAttribute(spans[0], semconv.HTTPRouteKey)
+		assert.True(t, ok)
+		assert.Equal(t, "/users/{id}", route.AsString())
+	})
+
+	t.Run("route and span name functions take precedence", func(t *testing.T) {
+		exp := &otelkit.FakeSpanExporter{}
+		mux := newMux(func(next http.Handler) http.Handler {
+			return otelkit.HTTPMiddlewareTracing{
+				Next:       next,
+				Tracer:     NewTracerProvider(exp).Tracer("tracer"),
+				UsePattern: true,
+				RouteFn:    func(r *http.Request) string { return "/custom/route" },
+				SpanNameFn: func(r *http.Request) string { return "custom-name" },
+			}
+		})
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+		spans := exp.ExportedSpans()
+		assert.Equal(t, 1, len(spans))
+		assert.Equal(t, "custom-name", spans[0].Name())
+		route, ok := spanAttribute(spans[0], semconv.HTTPRouteKey)
+		assert.True(t, ok)
+		assert.Equal(t, "/custom/route", route.AsString())
+	})
+}
@@ -0,0 +1,100 @@
+package otelkit
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"sync"
+)
+
+var defaultPropagator = struct {
+	m          sync.RWMutex
+	propagator propagation.TextMapPropagator
+}{}
+
+// SetDefaultPropagator sets the propagator that otelkit components use when their Propagator field is nil.
+// Setting it to nil makes them fall back to the global TextMapPropagator of the otel package again.
+func SetDefaultPropagator(p propagation.TextMapPropagator) {
+	defaultPropagator.m.Lock()
+	defer defaultPropagator.m.Unlock()
+	defaultPropagator.propagator = p
+}
+
+// DefaultPropagator returns the propagator set with SetDefaultPropagator,
+// or the global TextMapPropagator of the otel package when none was set.
+func DefaultPropagator() propagation.TextMapPropagator {
+	defaultPropagator.m.RLock()
+	defer defaultPropagator.m.RUnlock()
+	if defaultPropagator.propagator != nil {
+		return defaultPropagator.propagator
+	}
+	return otel.GetTextMapPropagator()
+}
+
+// StandardPropagator returns the composite of the W3C Trace Context and the W3C Baggage propagators,
+// which propagates both the trace context and the baggage.
+// Using the bare propagation.TraceContext instead is a common reason for the baggage to silently go missing.
+//
+// DefaultPropagator is kept as the name of the propagator that otelkit components fall back to,
+// so StandardPropagator is meant to be passed to SetDefaultPropagator or to otel.SetTextMapPropagator:
+//
+//	otelkit.SetDefaultPropagator(otelkit.StandardPropagator())
+func StandardPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// TraceStateStrippingPropagator propagates the tracing with Next, but without the tracestate.
+// It's an interop fix for downstreams that can't handle large or unknown tracestate entries.
+// Extract passes through to Next, so the inbound tracestate is still kept.
+// When Next is nil, DefaultPropagator is used.
+type TraceStateStrippingPropagator struct {
+	Next propagation.TextMapPropagator
+}
+
+const traceStateHeader = "tracestate"
+
+func (p TraceStateStrippingPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, sc.WithTraceState(trace.TraceState{}))
+	}
+	p.next().Inject(ctx, carrier)
+}
+
+func (p TraceStateStrippingPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return p.next().Extract(ctx, carrier)
+}
+
+func (p TraceStateStrippingPropagator) Fields() []string {
+	var fields []string
+	for _, field := range p.next().Fields() {
+		if field != traceStateHeader {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func (p TraceStateStrippingPropagator) next() propagation.TextMapPropagator {
+	if p.Next != nil {
+		return p.Next
+	}
+	return DefaultPropagator()
+}
+
+// ExtractSpanContext extracts the span context from the headers with the propagator.
+// Header keys are matched case-insensitively, just like with http.Header.
+// It never fails, malformed headers result in an invalid span context,
+// which makes it suitable to drive fuzz tests of the propagation with arbitrary input.
+// When the propagator is nil, DefaultPropagator is used.
+func ExtractSpanContext(propagator propagation.TextMapPropagator, headers map[string]string) trace.SpanContext {
+	if propagator == nil {
+		propagator = DefaultPropagator()
+	}
+	header := http.Header{}
+	for key, value := range headers {
+		header.Set(key, value)
+	}
+	return trace.SpanContextFromContext(propagator.Extract(context.Background(), propagation.HeaderCarrier(header)))
+}
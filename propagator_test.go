@@ -0,0 +1,170 @@
+package otelkit_test
+
+import (
+	"context"
+	"github.com/adamluzsi/otelkit"
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDefaultPropagator(t *testing.T) {
+	t.Run("global propagator is used by default", func(t *testing.T) {
+		ogPropagator := otel.GetTextMapPropagator()
+		t.Cleanup(func() { otel.SetTextMapPropagator(ogPropagator) })
+		otel.SetTextMapPropagator(CustomHeaderPropagator{})
+
+		assert.Equal[propagation.TextMapPropagator](t, CustomHeaderPropagator{}, otelkit.DefaultPropagator())
+	})
+
+	t.Run("configured default propagator is used", func(t *testing.T) {
+		t.Cleanup(func() { otelkit.SetDefaultPropagator(nil) })
+		otelkit.SetDefaultPropagator(CustomHeaderPropagator{})
+
+		assert.Equal[propagation.TextMapPropagator](t, CustomHeaderPropagator{}, otelkit.DefaultPropagator())
+
+		t.Run("by the round tripper when its propagator is nil", func(t *testing.T) {
+			var received *http.Request
+			ctx, _ := MakeTestSpanContext(nil)
+			req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			_, err := otelkit.HTTPRoundTripper{
+				Next: RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					received = r
+					return &http.Response{StatusCode: http.StatusOK}, nil
+				}),
+				Tracer: NewTracerProvider(&otelkit.FakeSpanExporter{}).Tracer("tracer"),
+			}.RoundTrip(req)
+			assert.NoError(t, err)
+			assert.NotNil(t, received)
+			assert.NotEmpty(t, received.Header.Get("X-Custom-Trace-Id"))
+		})
+
+		t.Run("by the middlewares when their propagator is nil", func(t *testing.T) {
+			var events []otelkit.NoTracingWarningEvent
+			otelkit.HTTPMiddlewareNoTracingWarning{
+				Next:     http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+				NotifyFn: func(event otelkit.NoTracingWarningEvent) { events = append(events, event) },
+			}.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, 1, len(events))
+			otelkit.AssertMissingHeaders(t, events[0], "x-custom-trace-id")
+
+			ctx, sc := MakeTestSpanContext(nil)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			CustomHeaderPropagator{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+			var got trace.SpanContext
+			otelkit.HTTPMiddlewareTracing{
+				Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					got = trace.SpanContextFromContext(r.Context())
+				}),
+				Tracer: NewTracerProvider(&otelkit.FakeSpanExporter{}).Tracer("tracer"),
+			}.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, sc.TraceID(), got.TraceID())
+		})
+	})
+
+	t.Run("resetting to nil falls back to the global propagator", func(t *testing.T) {
+		otelkit.SetDefaultPropagator(CustomHeaderPropagator{})
+		otelkit.SetDefaultPropagator(nil)
+
+		assert.Equal(t, otel.GetTextMapPropagator(), otelkit.DefaultPropagator())
+	})
+}
+
+func TestTraceStateStrippingPropagator(t *testing.T) {
+	ts, err := trace.ParseTraceState("vendor=" + strings.Repeat("x", 200))
+	assert.NoError(t, err)
+	_, sc := MakeTestSpanContext(nil)
+	sc = sc.WithTraceState(ts)
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	p := otelkit.TraceStateStrippingPropagator{Next: propagation.TraceContext{}}
+
+	t.Run("traceparent is injected without tracestate", func(t *testing.T) {
+		header := http.Header{}
+		p.Inject(ctx, propagation.HeaderCarrier(header))
+		assert.NotEmpty(t, header.Get("traceparent"))
+		assert.Empty(t, header.Get("tracestate"))
+
+		got := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(header)))
+		assert.Equal(t, sc.TraceID(), got.TraceID())
+		assert.Equal(t, sc.SpanID(), got.SpanID())
+	})
+
+	t.Run("tracestate is extracted", func(t *testing.T) {
+		header := http.Header{}
+		propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(header))
+		assert.NotEmpty(t, header.Get("tracestate"))
+
+		got := trace.SpanContextFromContext(p.Extract(context.Background(), propagation.HeaderCarrier(header)))
+		assert.Equal(t, sc.TraceID(), got.TraceID())
+		assert.Equal(t, ts.String(), got.TraceState().String())
+	})
+
+	t.Run("tracestate is not among the fields", func(t *testing.T) {
+		assert.Equal(t, []string{"traceparent"}, p.Fields())
+	})
+}
+
+func TestExtractSpanContext(t *testing.T) {
+	ctx, sc := MakeTestSpanContext(nil)
+	header := http.Header{}
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(header))
+
+	t.Run("valid headers in any casing", func(t *testing.T) {
+		got := otelkit.ExtractSpanContext(propagation.TraceContext{}, map[string]string{"TraceParent": header.Get("traceparent")})
+		assert.True(t, got.IsValid())
+		assert.Equal(t, sc.TraceID(), got.TraceID())
+		assert.Equal(t, sc.SpanID(), got.SpanID())
+	})
+
+	t.Run("malformed headers", func(t *testing.T) {
+		got := otelkit.ExtractSpanContext(propagation.TraceContext{}, map[string]string{"traceparent": "00-not-a-trace-01"})
+		assert.False(t, got.IsValid())
+	})
+
+	t.Run("no headers", func(t *testing.T) {
+		assert.False(t, otelkit.ExtractSpanContext(propagation.TraceContext{}, nil).IsValid())
+	})
+}
+
+func FuzzExtractSpanContext(f *testing.F) {
+	f.Add("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "vendor=value")
+	f.Add("00-00000000000000000000000000000000-00f067aa0ba902b7-01", "")
+	f.Add("ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "=,=")
+	f.Add("", strings.Repeat("k=v,", 64))
+	p := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	f.Fuzz(func(t *testing.T, traceparent, tracestate string) {
+		sc := otelkit.ExtractSpanContext(p, map[string]string{
+			"traceparent": traceparent,
+			"tracestate":  tracestate,
+			"baggage":     tracestate,
+		})
+		if sc.IsValid() {
+			assert.True(t, sc.TraceID().IsValid())
+			assert.True(t, sc.SpanID().IsValid())
+		}
+	})
+}
+
+func TestStandardPropagator(t *testing.T) {
+	p := otelkit.StandardPropagator()
+	assert.ContainExactly(t, []string{"traceparent", "tracestate", "baggage"}, p.Fields())
+
+	member, err := baggage.NewMember("tenant", "42")
+	assert.NoError(t, err)
+	ctx, err := otelkit.ContextWithBaggage(context.Background(), member)
+	assert.NoError(t, err)
+	ctx, sc := MakeTestSpanContext(ctx)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	p.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	out := p.Extract(context.Background(), propagation.HeaderCarrier(req.Header))
+	assert.Equal(t, sc.TraceID(), trace.SpanContextFromContext(out).TraceID())
+	otelkit.AssertBaggage(t, out, "tenant", "42")
+}
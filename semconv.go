@@ -0,0 +1,142 @@
+package otelkit
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SemconvVersion selects the semantic conventions of the HTTP attributes
+// that the HTTP middlewares and round trippers of the package record on spans and metrics.
+type SemconvVersion int
+
+const (
+	// SemconvV1_7 records the attribute names of the semantic conventions v1.7.0, like http.method and http.url.
+	// It's the default, so the existing dashboards and queries keep working.
+	SemconvV1_7 SemconvVersion = iota
+	// SemconvV1_21 records the stable HTTP attribute names of the semantic conventions v1.21.0,
+	// like http.request.method, url.full and http.response.status_code.
+	SemconvV1_21
+)
+
+// httpAttributes builds the HTTP attributes by the selected semantic conventions.
+type httpAttributes struct {
+	version SemconvVersion
+}
+
+const (
+	httpRequestMethodKey      = attribute.Key("http.request.method")
+	urlFullKey                = attribute.Key("url.full")
+	urlSchemeKey              = attribute.Key("url.scheme")
+	serverAddressKey          = attribute.Key("server.address")
+	httpRequestBodySizeKey    = attribute.Key("http.request.body.size")
+	httpResponseBodySizeKey   = attribute.Key("http.response.body.size")
+	httpResponseStatusCodeKey = attribute.Key("http.response.status_code")
+	urlPathKey                = attribute.Key("url.path")
+	clientAddressKey          = attribute.Key("client.address")
+	userAgentOriginalKey      = attribute.Key("user_agent.original")
+)
+
+// server returns the attributes of an inbound request, and its route when it's not empty.
+func (a httpAttributes) server(r *http.Request, route string) []attribute.KeyValue {
+	if a.version != SemconvV1_21 {
+		return semconv.HTTPServerAttributesFromHTTPRequest("", route, r)
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	attrs := []attribute.KeyValue{
+		httpRequestMethodKey.String(r.Method),
+		urlPathKey.String(r.URL.Path),
+		urlSchemeKey.String(scheme),
+		serverAddressKey.String(hostname(r.Host)),
+	}
+	if route != "" {
+		attrs = append(attrs, a.route(route))
+	}
+	if addr := clientAddress(r); addr != "" {
+		attrs = append(attrs, clientAddressKey.String(addr))
+	}
+	if ua := r.UserAgent(); ua != "" {
+		attrs = append(attrs, userAgentOriginalKey.String(ua))
+	}
+	return attrs
+}
+
+func hostname(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
+
+// clientAddress prefers the first address of the X-Forwarded-For header over the remote address of the connection.
+func clientAddress(r *http.Request) string {
+	if values := r.Header["X-Forwarded-For"]; len(values) > 0 {
+		addr, _, _ := strings.Cut(values[0], ",")
+		return strings.TrimSpace(addr)
+	}
+	return hostname(r.RemoteAddr)
+}
+
+func (a httpAttributes) method(method string) attribute.KeyValue {
+	if a.version == SemconvV1_21 {
+		return httpRequestMethodKey.String(method)
+	}
+	return semconv.HTTPMethodKey.String(method)
+}
+
+// route is http.route in both conventions.
+func (a httpAttributes) route(route string) attribute.KeyValue {
+	return semconv.HTTPRouteKey.String(route)
+}
+
+// host returns the host of an outbound request's URL.
+func (a httpAttributes) host(u *url.URL) attribute.KeyValue {
+	if a.version == SemconvV1_21 {
+		return serverAddressKey.String(u.Hostname())
+	}
+	return semconv.HTTPHostKey.String(u.Host)
+}
+
+func (a httpAttributes) request(r *http.Request) []attribute.KeyValue {
+	if a.version == SemconvV1_21 {
+		return []attribute.KeyValue{
+			httpRequestMethodKey.String(r.Method),
+			urlFullKey.String(r.URL.String()),
+			urlSchemeKey.String(r.URL.Scheme),
+			serverAddressKey.String(r.URL.Hostname()),
+		}
+	}
+	return []attribute.KeyValue{
+		semconv.HTTPMethodKey.String(r.Method),
+		semconv.HTTPURLKey.String(r.URL.String()),
+		semconv.HTTPSchemeKey.String(r.URL.Scheme),
+		semconv.HTTPHostKey.String(r.Host),
+	}
+}
+
+func (a httpAttributes) requestContentLength(n int64) attribute.KeyValue {
+	if a.version == SemconvV1_21 {
+		return httpRequestBodySizeKey.Int64(n)
+	}
+	return semconv.HTTPRequestContentLengthKey.Int64(n)
+}
+
+func (a httpAttributes) responseContentLength(n int64) attribute.KeyValue {
+	if a.version == SemconvV1_21 {
+		return httpResponseBodySizeKey.Int64(n)
+	}
+	return semconv.HTTPResponseContentLengthKey.Int64(n)
+}
+
+func (a httpAttributes) statusCode(code int) attribute.KeyValue {
+	if a.version == SemconvV1_21 {
+		return httpResponseStatusCodeKey.Int(code)
+	}
+	return semconv.HTTPStatusCodeKey.Int(code)
+}
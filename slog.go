@@ -0,0 +1,70 @@
+//go:build go1.21
+
+package otelkit
+
+import (
+	"context"
+	"log/slog"
+)
+
+// TraceHandler is a slog.Handler that adds the trace_id and span_id of the record's context to the log records,
+// which correlates the logs with the traces.
+// Records logged with a context without a valid span context are passed to Next as they are.
+// The ids are always top-level attributes, even when the logger has groups, like the one of logger.WithGroup("req").
+type TraceHandler struct {
+	Next slog.Handler
+
+	// root is the Next of the TraceHandler that the derived handlers are made from,
+	// and ops replay the derivations on it after the ids are added, so the ids stay out of the groups.
+	// The replay is only needed when grouped, otherwise the ids are added to the record.
+	root    slog.Handler
+	ops     []func(slog.Handler) slog.Handler
+	grouped bool
+}
+
+const (
+	traceIDLogKey = "trace_id"
+	spanIDLogKey  = "span_id"
+)
+
+func (h TraceHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.Next.Enabled(ctx, level)
+}
+
+func (h TraceHandler) Handle(ctx context.Context, record slog.Record) error {
+	traceID, spanID, ok := SpanIDs(ctx)
+	if !ok {
+		return h.Next.Handle(ctx, record)
+	}
+	if !h.grouped {
+		record = record.Clone()
+		record.AddAttrs(slog.String(traceIDLogKey, traceID), slog.String(spanIDLogKey, spanID))
+		return h.Next.Handle(ctx, record)
+	}
+	next := h.rootHandler().WithAttrs([]slog.Attr{slog.String(traceIDLogKey, traceID), slog.String(spanIDLogKey, spanID)})
+	for _, op := range h.ops {
+		next = op(next)
+	}
+	return next.Handle(ctx, record)
+}
+
+func (h TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.derive(h.Next.WithAttrs(attrs), false, func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h TraceHandler) WithGroup(name string) slog.Handler {
+	return h.derive(h.Next.WithGroup(name), true, func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h TraceHandler) derive(next slog.Handler, group bool, op func(slog.Handler) slog.Handler) TraceHandler {
+	ops := make([]func(slog.Handler) slog.Handler, 0, len(h.ops)+1)
+	ops = append(append(ops, h.ops...), op)
+	return TraceHandler{Next: next, root: h.rootHandler(), ops: ops, grouped: h.grouped || group}
+}
+
+func (h TraceHandler) rootHandler() slog.Handler {
+	if h.root != nil {
+		return h.root
+	}
+	return h.Next
+}
@@ -0,0 +1,75 @@
+//go:build go1.21
+
+package otelkit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/adamluzsi/otelkit"
+	"github.com/adamluzsi/testcase/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestTraceHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(otelkit.TraceHandler{Next: slog.NewJSONHandler(buf, nil)})
+	lastRecord := func(t *testing.T) map[string]any {
+		var record map[string]any
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		buf.Reset()
+		return record
+	}
+
+	t.Run("context with span", func(t *testing.T) {
+		ctx, sc := MakeTestSpanContext(nil)
+		logger.InfoContext(ctx, "hello", "key", "value")
+
+		record := lastRecord(t)
+		assert.Equal[any](t, sc.TraceID().String(), record["trace_id"])
+		assert.Equal[any](t, sc.SpanID().String(), record["span_id"])
+		assert.Equal[any](t, "value", record["key"])
+	})
+
+	t.Run("context without span", func(t *testing.T) {
+		logger.InfoContext(context.Background(), "hello")
+
+		record := lastRecord(t)
+		_, ok := record["trace_id"]
+		assert.False(t, ok)
+		_, ok = record["span_id"]
+		assert.False(t, ok)
+	})
+
+	t.Run("derived logger keeps adding the ids", func(t *testing.T) {
+		ctx, sc := MakeTestSpanContext(nil)
+		logger.With("component", "test").InfoContext(ctx, "hello")
+
+		record := lastRecord(t)
+		assert.Equal[any](t, sc.TraceID().String(), record["trace_id"])
+		assert.Equal[any](t, "test", record["component"])
+	})
+
+	t.Run("ids stay top-level when the logger has groups", func(t *testing.T) {
+		ctx, sc := MakeTestSpanContext(nil)
+		logger.With("component", "test").WithGroup("req").With("b", 2).InfoContext(ctx, "hello", "a", 1)
+
+		record := lastRecord(t)
+		assert.Equal[any](t, sc.TraceID().String(), record["trace_id"])
+		assert.Equal[any](t, sc.SpanID().String(), record["span_id"])
+		assert.Equal[any](t, "test", record["component"])
+		group, ok := record["req"].(map[string]any)
+		assert.True(t, ok)
+		assert.Equal[any](t, map[string]any{"a": 1.0, "b": 2.0}, group)
+	})
+
+	t.Run("grouped logger without span", func(t *testing.T) {
+		logger.WithGroup("req").InfoContext(context.Background(), "hello", "a", 1)
+
+		record := lastRecord(t)
+		_, ok := record["trace_id"]
+		assert.False(t, ok)
+		assert.Equal[any](t, map[string]any{"a": 1.0}, record["req"])
+	})
+}
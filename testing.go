@@ -3,11 +3,23 @@ package otelkit
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	metricSDK "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
 	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
+	"time"
 )
 
 type testingTB interface {
@@ -18,16 +30,69 @@ type testingTB interface {
 	Errorf(format string, args ...any)
 }
 
+// TB is the subset of testing.TB that the otelkit test helpers depend on.
+type TB = testingTB
+
+// SpanCapturer is a span exporter double that captures the exported spans for assertions.
+// FakeSpanExporter implements it, but helpers depending on SpanCapturer accept custom capturing exporters too.
+type SpanCapturer interface {
+	ExportedSpans() []traceSDK.ReadOnlySpan
+	Pretty(tb TB) string
+	Reset()
+}
+
+// MergeSpans concatenates the spans captured by the exporters, in argument order.
+// It's meant for tests where multiple TracerProviders capture the spans.
+func MergeSpans(exporters ...*FakeSpanExporter) []traceSDK.ReadOnlySpan {
+	var spans []traceSDK.ReadOnlySpan
+	for _, exporter := range exporters {
+		spans = append(spans, exporter.ExportedSpans()...)
+	}
+	return spans
+}
+
 type Stubs struct {
 	SpanExporter   *FakeSpanExporter
 	TracerProvider *traceSDK.TracerProvider
+	// Propagator is the global TextMapPropagator while the stub is in place,
+	// which propagates both the trace context and the baggage.
+	Propagator propagation.TextMapPropagator
+	// MeterProvider is the global MeterProvider while the stub is in place.
+	// Its measurements are read with CollectMetrics.
+	MeterProvider *metricSDK.MeterProvider
+	MetricReader  metricSDK.Reader
+}
+
+// StubWithPropagator stubs just like Stub, and also sets the stubbed propagator as the DefaultPropagator,
+// so the otelkit components without a Propagator use it even when SetDefaultPropagator was called before.
+// The previous default propagator is restored on cleanup.
+func StubWithPropagator(tb testingTB) *Stubs {
+	tb.Helper()
+	defaultPropagator.m.RLock()
+	ogDefault := defaultPropagator.propagator
+	defaultPropagator.m.RUnlock()
+	stubs := Stub(tb)
+	tb.Cleanup(func() { SetDefaultPropagator(ogDefault) })
+	SetDefaultPropagator(stubs.Propagator)
+	return stubs
+}
+
+// CollectMetrics returns the metrics recorded with the stubbed MeterProvider so far.
+func (stubs *Stubs) CollectMetrics(tb testingTB) metricdata.ResourceMetrics {
+	tb.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := stubs.MetricReader.Collect(context.Background(), &rm); err != nil {
+		tb.Fatalf("%s", err.Error())
+	}
+	return rm
 }
 
 func Stub(tb testingTB) *Stubs {
 	tb.Helper()
 
 	ogTP := otel.GetTracerProvider()
-	tb.Cleanup(func() { otel.SetTracerProvider(ogTP) }) // restore OG TraceProvider
+	ogPropagator := otel.GetTextMapPropagator()
+	ogMP := otel.GetMeterProvider()
 
 	spanExporter := &FakeSpanExporter{}
 
@@ -36,15 +101,122 @@ func Stub(tb testingTB) *Stubs {
 			traceSDK.NewSimpleSpanProcessor(
 				spanExporter)))
 
+	// Cleanup callbacks run in last added, first called order, even when the test panics.
+	// The OG TracerProvider must be restored before the stub is shut down,
+	// so the global TracerProvider never points to a shut down TracerProvider.
+	tb.Cleanup(func() {
+		if err := tracerProvider.Shutdown(context.Background()); err != nil {
+			tb.Errorf("%v", err)
+		}
+	})
+	metricReader := metricSDK.NewManualReader()
+	meterProvider := metricSDK.NewMeterProvider(metricSDK.WithReader(metricReader))
+	tb.Cleanup(func() {
+		if err := meterProvider.Shutdown(context.Background()); err != nil {
+			tb.Errorf("%v", err)
+		}
+	})
+	tb.Cleanup(func() { otel.SetTracerProvider(ogTP) }) // restore OG TraceProvider
+	tb.Cleanup(func() { otel.SetTextMapPropagator(ogPropagator) })
+	tb.Cleanup(func() { otel.SetMeterProvider(ogMP) })
+
+	propagator := StandardPropagator()
 	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagator)
+	otel.SetMeterProvider(meterProvider)
 
 	return &Stubs{
 		SpanExporter:   spanExporter,
 		TracerProvider: tracerProvider,
+		Propagator:     propagator,
+		MeterProvider:  meterProvider,
+		MetricReader:   metricReader,
 	}
 
 }
 
+// ServeAndCapture serves the request with the handler while the global TracerProvider is stubbed,
+// and returns the response together with the spans exported during the request.
+func ServeAndCapture(tb testingTB, handler http.Handler, req *http.Request) (*http.Response, []traceSDK.ReadOnlySpan) {
+	tb.Helper()
+	stub := Stub(tb)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr.Result(), stub.SpanExporter.ExportedSpans()
+}
+
+// NewTestTracerProvider makes a TracerProvider that synchronously exports to the span exporter,
+// and has a resource with the given service.name, like a TracerProvider configured for production would.
+func NewTestTracerProvider(exporter traceSDK.SpanExporter, serviceName string) *traceSDK.TracerProvider {
+	return traceSDK.NewTracerProvider(
+		traceSDK.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName))),
+		traceSDK.WithSpanProcessor(
+			traceSDK.NewSimpleSpanProcessor(
+				exporter)))
+}
+
+// MakeMalformedTracingRequest makes an inbound request like httptest.NewRequest,
+// but with a traceparent header that is present yet garbled, as some misbehaving clients send it.
+func MakeMalformedTracingRequest(method, target string, body io.Reader) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	r.Header.Set(traceparentHeader, malformedTraceParent)
+	return r
+}
+
+const malformedTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-not-a-span-id-01"
+
+// RegisterSpanDump makes the captured spans of the exporter logged in a pretty format at the end of the test,
+// but only when the test failed.
+// When tb has no Failed method to tell it, the spans are logged regardless.
+func RegisterSpanDump(tb testingTB, exporter SpanCapturer) {
+	tb.Helper()
+	tb.Cleanup(func() {
+		if f, ok := tb.(interface{ Failed() bool }); !ok || f.Failed() {
+			tb.Logf("captured spans:\n%s", exporter.Pretty(tb))
+		}
+	})
+}
+
+// MakeTracedContext makes a context for tests that has both a recording span and the given baggage members.
+// The span is ended at the end of the test, unless it was ended earlier.
+func MakeTracedContext(tb testingTB, members ...baggage.Member) (context.Context, trace.Span) {
+	tb.Helper()
+	tp := traceSDK.NewTracerProvider()
+	tb.Cleanup(func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			tb.Errorf("%v", err)
+		}
+	})
+	ctx, span := tp.Tracer(instrumentationName, trace.WithInstrumentationVersion(Version)).Start(context.Background(), "test-span")
+	tb.Cleanup(func() { span.End() })
+	ctx, err := ContextWithBaggage(ctx, members...)
+	if err != nil {
+		tb.Fatalf("expected no error but got: %v", err)
+	}
+	return ctx, span
+}
+
+// NewTracedTestClient makes an http.Client for tests, which traces the outbound requests with HTTPRoundTripper,
+// and propagates the tracing in the W3C Trace Context format.
+// The returned FakeSpanExporter captures the spans of the client.
+func NewTracedTestClient(tb testingTB) (*http.Client, *FakeSpanExporter) {
+	tb.Helper()
+	exporter := &FakeSpanExporter{}
+	tp := traceSDK.NewTracerProvider(traceSDK.WithSpanProcessor(traceSDK.NewSimpleSpanProcessor(exporter)))
+	tb.Cleanup(func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			tb.Errorf("%v", err)
+		}
+	})
+	client := &http.Client{Transport: HTTPRoundTripper{
+		Next:       http.DefaultTransport,
+		Propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+		Tracer:     tp.Tracer(instrumentationName, trace.WithInstrumentationVersion(Version)),
+	}}
+	return client, exporter
+}
+
 func DebugSpanExporter(tb testingTB) traceSDK.SpanExporter {
 	tb.Helper()
 	buf := &bytes.Buffer{}
@@ -57,13 +229,7 @@ func DebugSpanExporter(tb testingTB) traceSDK.SpanExporter {
 
 func prettyPrintExporter(tb testingTB, writer io.Writer) traceSDK.SpanExporter {
 	tb.Helper()
-	se, err := stdouttrace.New(
-		stdouttrace.WithWriter(writer),
-		// Use human-readable output.
-		stdouttrace.WithPrettyPrint(),
-		// Do not print timestamps for the demo.
-		stdouttrace.WithoutTimestamps(),
-	)
+	se, err := NewPrettySpanExporter(writer)
 	if err != nil {
 		tb.Fatalf("expected no error but got: %v", err)
 	}
@@ -76,7 +242,8 @@ func prettyPrintExporter(tb testingTB, writer io.Writer) traceSDK.SpanExporter {
 }
 
 type FakeSpanExporter struct {
-	spans []traceSDK.ReadOnlySpan
+	spans   []traceSDK.ReadOnlySpan
+	batches [][]traceSDK.ReadOnlySpan
 
 	m sync.Mutex
 }
@@ -85,6 +252,8 @@ func (exp *FakeSpanExporter) ExportSpans(ctx context.Context, spans []traceSDK.R
 	exp.m.Lock()
 	defer exp.m.Unlock()
 	exp.spans = append(exp.spans, spans...)
+	// span processors may reuse the slice of the batch, so it's copied
+	exp.batches = append(exp.batches, append([]traceSDK.ReadOnlySpan{}, spans...))
 	return nil
 }
 
@@ -94,6 +263,147 @@ func (exp *FakeSpanExporter) ExportedSpans() []traceSDK.ReadOnlySpan {
 	return append([]traceSDK.ReadOnlySpan{}, exp.spans...)
 }
 
+// ExportBatches returns the spans grouped by the ExportSpans calls that exported them,
+// which makes it possible to verify the batching behaviour of a span processor.
+func (exp *FakeSpanExporter) ExportBatches() [][]traceSDK.ReadOnlySpan {
+	exp.m.Lock()
+	defer exp.m.Unlock()
+	batches := make([][]traceSDK.ReadOnlySpan, 0, len(exp.batches))
+	for _, batch := range exp.batches {
+		batches = append(batches, append([]traceSDK.ReadOnlySpan{}, batch...))
+	}
+	return batches
+}
+
+// IsEmpty tells whether no span was exported.
+func (exp *FakeSpanExporter) IsEmpty() bool {
+	exp.m.Lock()
+	defer exp.m.Unlock()
+	return len(exp.spans) == 0
+}
+
+// AssertEmpty fails the test if any span was exported.
+func (exp *FakeSpanExporter) AssertEmpty(tb testingTB) {
+	tb.Helper()
+	spans := exp.ExportedSpans()
+	if len(spans) == 0 {
+		return
+	}
+	var summaries []string
+	for _, span := range spans {
+		summaries = append(summaries, SpanSummary(span))
+	}
+	tb.Fatalf("expected no exported spans, but got %d:\n%s", len(spans), strings.Join(summaries, "\n"))
+}
+
+// SpansBetween returns the exported spans that started within the [start, end) time window.
+func (exp *FakeSpanExporter) SpansBetween(start, end time.Time) []traceSDK.ReadOnlySpan {
+	exp.m.Lock()
+	defer exp.m.Unlock()
+	var spans []traceSDK.ReadOnlySpan
+	for _, span := range exp.spans {
+		if st := span.StartTime(); !st.Before(start) && st.Before(end) {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// FindSpans returns the exported spans with the given name, in the order of their export.
+func (exp *FakeSpanExporter) FindSpans(name string) []traceSDK.ReadOnlySpan {
+	exp.m.Lock()
+	defer exp.m.Unlock()
+	var spans []traceSDK.ReadOnlySpan
+	for _, span := range exp.spans {
+		if span.Name() == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// FindSpan returns the first exported span with the given name.
+func (exp *FakeSpanExporter) FindSpan(name string) (traceSDK.ReadOnlySpan, bool) {
+	spans := exp.FindSpans(name)
+	if len(spans) == 0 {
+		return nil, false
+	}
+	return spans[0], true
+}
+
+// SpansWithAttribute returns the exported spans that carry the attribute with the given key and value.
+func (exp *FakeSpanExporter) SpansWithAttribute(key attribute.Key, value attribute.Value) []traceSDK.ReadOnlySpan {
+	return exp.spansWithAttribute(func(kv attribute.KeyValue) bool {
+		return kv.Key == key && kv.Value == value
+	})
+}
+
+// SpansWithAttributeKey returns the exported spans that carry an attribute with the given key, regardless of its value.
+func (exp *FakeSpanExporter) SpansWithAttributeKey(key attribute.Key) []traceSDK.ReadOnlySpan {
+	return exp.spansWithAttribute(func(kv attribute.KeyValue) bool {
+		return kv.Key == key
+	})
+}
+
+func (exp *FakeSpanExporter) spansWithAttribute(match func(attribute.KeyValue) bool) []traceSDK.ReadOnlySpan {
+	exp.m.Lock()
+	defer exp.m.Unlock()
+	var spans []traceSDK.ReadOnlySpan
+	for _, span := range exp.spans {
+		for _, kv := range span.Attributes() {
+			if match(kv) {
+				spans = append(spans, span)
+				break
+			}
+		}
+	}
+	return spans
+}
+
+// Len returns the number of the exported spans.
+func (exp *FakeSpanExporter) Len() int {
+	exp.m.Lock()
+	defer exp.m.Unlock()
+	return len(exp.spans)
+}
+
+// Events collects the events of the exported spans with the given name, in the order of their export.
+func (exp *FakeSpanExporter) Events(spanName string) []traceSDK.Event {
+	exp.m.Lock()
+	defer exp.m.Unlock()
+	var events []traceSDK.Event
+	for _, span := range exp.spans {
+		if span.Name() == spanName {
+			events = append(events, span.Events()...)
+		}
+	}
+	return events
+}
+
+// EventCount counts the events with the given name across all the exported spans.
+func (exp *FakeSpanExporter) EventCount(name string) int {
+	exp.m.Lock()
+	defer exp.m.Unlock()
+	var count int
+	for _, span := range exp.spans {
+		for _, event := range span.Events() {
+			if event.Name == name {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Reset discards the exported spans, so the exporter can be reused between test cases.
+// It's safe to call concurrently with ExportSpans.
+func (exp *FakeSpanExporter) Reset() {
+	exp.m.Lock()
+	defer exp.m.Unlock()
+	exp.spans = nil
+	exp.batches = nil
+}
+
 func (exp *FakeSpanExporter) Shutdown(ctx context.Context) error { return nil }
 
 func (exp *FakeSpanExporter) Pretty(tb testingTB) string {
@@ -106,3 +416,38 @@ func (exp *FakeSpanExporter) Pretty(tb testingTB) string {
 	}
 	return buf.String()
 }
+
+// String renders the exported spans in the same human-readable format as Pretty, but without a testing.TB,
+// so the spans can be dumped outside of tests too.
+// When the spans can't be rendered, the error message is returned instead.
+func (exp *FakeSpanExporter) String() string {
+	exp.m.Lock()
+	defer exp.m.Unlock()
+	buf := &bytes.Buffer{}
+	se, err := NewPrettySpanExporter(buf)
+	if err != nil {
+		return err.Error()
+	}
+	if err := se.ExportSpans(context.Background(), exp.spans); err != nil {
+		return err.Error()
+	}
+	return buf.String()
+}
+
+// SpanSummary describes the span in a single line, which is compact enough for test failure messages.
+func SpanSummary(span traceSDK.ReadOnlySpan) string {
+	buf := &strings.Builder{}
+	sc := span.SpanContext()
+	_, _ = fmt.Fprintf(buf, "%q trace_id=%s span_id=%s", span.Name(), sc.TraceID(), sc.SpanID())
+	if parent := span.Parent(); parent.IsValid() {
+		_, _ = fmt.Fprintf(buf, " parent_span_id=%s", parent.SpanID())
+	}
+	_, _ = fmt.Fprintf(buf, " kind=%s status=%s", span.SpanKind(), span.Status().Code)
+	if desc := span.Status().Description; desc != "" {
+		_, _ = fmt.Fprintf(buf, "(%q)", desc)
+	}
+	for _, kv := range span.Attributes() {
+		_, _ = fmt.Fprintf(buf, " %s=%s", kv.Key, kv.Value.Emit())
+	}
+	return buf.String()
+}
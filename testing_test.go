@@ -2,14 +2,25 @@ package otelkit_test
 
 import (
 	"context"
+	"fmt"
 	"github.com/adamluzsi/otelkit"
 	"github.com/adamluzsi/testcase"
 	"github.com/adamluzsi/testcase/assert"
 	"github.com/adamluzsi/testcase/random"
+	"github.com/adamluzsi/testcase/sandbox"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
@@ -49,6 +60,21 @@ func TestNewTraceProvider_smoke(t *testing.T) {
 	assert.True(t, spancContext.SpanID().IsValid())
 }
 
+func TestNewTestTracerProvider(t *testing.T) {
+	rnd := random.New(random.CryptoSeed{})
+	serviceName := rnd.StringNC(8, random.CharsetAlpha())
+	fake := &otelkit.FakeSpanExporter{}
+
+	_, span := otelkit.NewTestTracerProvider(fake, serviceName).Tracer("trace").Start(context.Background(), "span")
+	span.End()
+
+	spans := fake.ExportedSpans()
+	assert.Equal(t, 1, len(spans))
+	value, ok := spans[0].Resource().Set().Value(semconv.ServiceNameKey)
+	assert.True(t, ok)
+	assert.Equal(t, serviceName, value.AsString())
+}
+
 func TestMakeSpanContext(t *testing.T) {
 	s := testcase.NewSpec(t)
 	s.NoSideEffect()
@@ -125,7 +151,10 @@ func TestMakeSpanContext(t *testing.T) {
 	})
 }
 
-var _ traceSDK.SpanExporter = &otelkit.FakeSpanExporter{}
+var (
+	_ traceSDK.SpanExporter = &otelkit.FakeSpanExporter{}
+	_ otelkit.SpanCapturer  = &otelkit.FakeSpanExporter{}
+)
 
 func TestFakeSpanExporter_ExportSpans(t *testing.T) {
 	exp := &otelkit.FakeSpanExporter{}
@@ -142,6 +171,255 @@ func TestFakeSpanExporter_ExportSpans(t *testing.T) {
 	assert.Contain(t, exp.Pretty(t), "EventName")
 }
 
+func TestFakeSpanExporter_String(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	var _ fmt.Stringer = exp
+
+	_, span := NewTracerProvider(exp).Tracer("TracerName").Start(context.Background(), "SpanName")
+	span.AddEvent("EventName")
+	span.End()
+
+	assert.Contain(t, exp.String(), "TracerName")
+	assert.Contain(t, exp.String(), "SpanName")
+	assert.Contain(t, exp.String(), "EventName")
+	assert.Equal(t, exp.Pretty(t), exp.String())
+}
+
+func TestFakeSpanExporter_Len(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	assert.Equal(t, 0, exp.Len())
+
+	tp := NewTracerProvider(exp)
+	for i := 0; i < 3; i++ {
+		_, span := tp.Tracer("TracerName").Start(context.Background(), "SpanName")
+		span.End()
+	}
+	assert.Equal(t, 3, exp.Len())
+}
+
+func TestFakeSpanExporter_Events(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tp := NewTracerProvider(exp)
+	for _, name := range []string{"A", "B", "A"} {
+		_, span := tp.Tracer("TracerName").Start(context.Background(), name)
+		span.AddEvent(name + "-event")
+		span.End()
+	}
+
+	events := exp.Events("A")
+	assert.Equal(t, 2, len(events))
+	for _, event := range events {
+		assert.Equal(t, "A-event", event.Name)
+	}
+	assert.Equal(t, 1, len(exp.Events("B")))
+	assert.Empty(t, exp.Events("C"))
+}
+
+func TestFakeSpanExporter_Reset(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+
+	tp := NewTracerProvider(exp)
+	_, span := tp.Tracer("TracerName").Start(context.Background(), "SpanName")
+	span.End()
+	assert.NotEmpty(t, exp.ExportedSpans())
+
+	exp.Reset()
+	assert.Empty(t, exp.ExportedSpans())
+
+	_, span = tp.Tracer("TracerName").Start(context.Background(), "OtherSpanName")
+	span.End()
+	assert.Equal(t, 1, len(exp.ExportedSpans()))
+	assert.Equal(t, "OtherSpanName", exp.ExportedSpans()[0].Name())
+}
+
+func TestFakeSpanExporter_Reset_concurrently(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tp := NewTracerProvider(exp)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, span := tp.Tracer("TracerName").Start(context.Background(), "SpanName")
+			span.End()
+		}()
+		go func() {
+			defer wg.Done()
+			exp.Reset()
+		}()
+	}
+	wg.Wait()
+
+	exp.Reset()
+	assert.True(t, exp.IsEmpty())
+	assert.Empty(t, exp.ExportBatches())
+}
+
+func TestFakeSpanExporter_FindSpans(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tp := NewTracerProvider(exp)
+	for _, name := range []string{"A", "B", "A"} {
+		_, span := tp.Tracer("TracerName").Start(context.Background(), name)
+		span.AddEvent(name)
+		span.End()
+	}
+
+	t.Run("all the spans with the name are returned", func(t *testing.T) {
+		spans := exp.FindSpans("A")
+		assert.Equal(t, 2, len(spans))
+		for _, span := range spans {
+			assert.Equal(t, "A", span.Name())
+		}
+		assert.Empty(t, exp.FindSpans("C"))
+	})
+
+	t.Run("the first span with the name is found", func(t *testing.T) {
+		span, ok := exp.FindSpan("A")
+		assert.True(t, ok)
+		assert.Equal(t, exp.ExportedSpans()[0], span)
+
+		span, ok = exp.FindSpan("B")
+		assert.True(t, ok)
+		assert.Equal(t, "B", span.Name())
+	})
+
+	t.Run("missing span is reported", func(t *testing.T) {
+		_, ok := exp.FindSpan("C")
+		assert.False(t, ok)
+	})
+}
+
+func TestFakeSpanExporter_SpansWithAttribute(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tp := NewTracerProvider(exp)
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPost} {
+		_, span := tp.Tracer("TracerName").Start(context.Background(), method,
+			trace.WithAttributes(semconv.HTTPMethodKey.String(method)))
+		span.End()
+	}
+	_, span := tp.Tracer("TracerName").Start(context.Background(), "NoMethod")
+	span.End()
+
+	t.Run("spans with the attribute key and value are returned", func(t *testing.T) {
+		spans := exp.SpansWithAttribute(semconv.HTTPMethodKey, attribute.StringValue(http.MethodGet))
+		assert.Equal(t, 1, len(spans))
+		assert.Equal(t, http.MethodGet, spans[0].Name())
+
+		assert.Equal(t, 2, len(exp.SpansWithAttribute(semconv.HTTPMethodKey, attribute.StringValue(http.MethodPost))))
+		assert.Empty(t, exp.SpansWithAttribute(semconv.HTTPMethodKey, attribute.StringValue(http.MethodPut)))
+	})
+
+	t.Run("spans with the attribute key are returned regardless of the value", func(t *testing.T) {
+		spans := exp.SpansWithAttributeKey(semconv.HTTPMethodKey)
+		assert.Equal(t, 3, len(spans))
+		for _, span := range spans {
+			assert.NotEqual(t, "NoMethod", span.Name())
+		}
+		assert.Empty(t, exp.SpansWithAttributeKey(semconv.HTTPStatusCodeKey))
+	})
+}
+
+func TestFakeSpanExporter_ExportBatches(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tp := traceSDK.NewTracerProvider(traceSDK.WithBatcher(exp,
+		traceSDK.WithMaxExportBatchSize(2),
+		traceSDK.WithBatchTimeout(time.Hour)))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	assert.Empty(t, exp.ExportBatches())
+
+	for _, name := range []string{"A", "B", "C"} {
+		_, span := tp.Tracer("TracerName").Start(context.Background(), name)
+		span.End()
+	}
+	assert.NoError(t, tp.ForceFlush(context.Background()))
+
+	batches := exp.ExportBatches()
+	assert.Equal(t, 2, len(batches))
+	assert.Equal(t, 2, len(batches[0]))
+	assert.Equal(t, 1, len(batches[1]))
+	assert.Equal(t, "C", batches[1][0].Name())
+	assert.Equal(t, 3, len(exp.ExportedSpans()))
+
+	exp.Reset()
+	assert.Empty(t, exp.ExportBatches())
+}
+
+func TestFakeSpanExporter_SpansBetween(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tracer := NewTracerProvider(exp).Tracer("TracerName")
+	phase := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	startSpan := func(name string, start time.Time) {
+		_, span := tracer.Start(context.Background(), name, trace.WithTimestamp(start))
+		span.End(trace.WithTimestamp(start.Add(time.Second)))
+	}
+	startSpan("before", phase.Add(-time.Minute))
+	startSpan("at-start", phase)
+	startSpan("within", phase.Add(30*time.Second))
+	startSpan("at-end", phase.Add(time.Minute))
+
+	var names []string
+	for _, span := range exp.SpansBetween(phase, phase.Add(time.Minute)) {
+		names = append(names, span.Name())
+	}
+	assert.Equal(t, []string{"at-start", "within"}, names)
+	assert.Empty(t, exp.SpansBetween(phase.Add(time.Hour), phase.Add(2*time.Hour)))
+}
+
+func TestMergeSpans(t *testing.T) {
+	expA := &otelkit.FakeSpanExporter{}
+	expB := &otelkit.FakeSpanExporter{}
+	for _, v := range []struct {
+		exp  *otelkit.FakeSpanExporter
+		name string
+	}{{expA, "A1"}, {expB, "B1"}, {expA, "A2"}} {
+		_, span := NewTracerProvider(v.exp).Tracer("TracerName").Start(context.Background(), v.name)
+		span.End()
+	}
+
+	var names []string
+	for _, span := range otelkit.MergeSpans(expA, expB) {
+		names = append(names, span.Name())
+	}
+	assert.Equal(t, []string{"A1", "A2", "B1"}, names)
+	assert.Equal(t, 3, len(otelkit.MergeSpans([]*otelkit.FakeSpanExporter{expA, expB}...)))
+	assert.Empty(t, otelkit.MergeSpans())
+}
+
+func TestFakeSpanExporter_IsEmpty(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	assert.True(t, exp.IsEmpty())
+	assertPasses(t, func(stub *testcase.StubTB) { exp.AssertEmpty(stub) })
+
+	_, span := NewTracerProvider(exp).Tracer("TracerName").Start(context.Background(), "SpanName")
+	span.End()
+	assert.False(t, exp.IsEmpty())
+	logs := assertFails(t, func(stub *testcase.StubTB) { exp.AssertEmpty(stub) })
+	assert.Contain(t, logs, "SpanName")
+
+	exp.Reset()
+	assert.True(t, exp.IsEmpty())
+}
+
+func TestFakeSpanExporter_EventCount(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tracer := NewTracerProvider(exp).Tracer("TracerName")
+	assert.Equal(t, 0, exp.EventCount("retry"))
+
+	_, span := tracer.Start(context.Background(), "SpanName")
+	span.AddEvent("retry")
+	span.AddEvent("retry")
+	span.AddEvent("redirect")
+	span.End()
+	_, span = tracer.Start(context.Background(), "OtherSpanName")
+	span.AddEvent("retry")
+	span.End()
+
+	assert.Equal(t, 3, exp.EventCount("retry"))
+	assert.Equal(t, 1, exp.EventCount("redirect"))
+	assert.Equal(t, 0, exp.EventCount("unknown"))
+}
+
 func TestFakeSpanExporter_ExportedSpans_race(t *testing.T) {
 	var (
 		exp = &otelkit.FakeSpanExporter{}
@@ -174,6 +452,263 @@ func TestStub(t *testing.T) {
 	assert.Contain(t, exp.Pretty(t), "EventName")
 }
 
+func TestStub_propagator(t *testing.T) {
+	ogPropagator := otel.GetTextMapPropagator()
+
+	stubTB := &testcase.StubTB{}
+	stub := otelkit.Stub(stubTB)
+	assert.NotNil(t, stub.Propagator)
+	assert.ContainExactly(t, stub.Propagator.Fields(), otel.GetTextMapPropagator().Fields())
+	assert.Contain(t, stub.Propagator.Fields(), "traceparent")
+	assert.Contain(t, stub.Propagator.Fields(), "baggage")
+
+	ctx, span := stub.TracerProvider.Tracer("TracerName").Start(context.Background(), "SpanName")
+	defer span.End()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	sc := trace.SpanContextFromContext(stub.Propagator.Extract(context.Background(), propagation.HeaderCarrier(req.Header)))
+	assert.Equal(t, span.SpanContext().TraceID(), sc.TraceID())
+
+	stubTB.Finish()
+	assert.Equal(t, ogPropagator, otel.GetTextMapPropagator())
+}
+
+func TestStub_metrics(t *testing.T) {
+	ogMP := otel.GetMeterProvider()
+
+	stubTB := &testcase.StubTB{}
+	stub := otelkit.Stub(stubTB)
+	assert.True(t, otel.GetMeterProvider() == metric.MeterProvider(stub.MeterProvider))
+
+	counter, err := otel.GetMeterProvider().Meter("MeterName").Int64Counter("requests")
+	assert.NoError(t, err)
+	counter.Add(context.Background(), 3)
+
+	rm := stub.CollectMetrics(stubTB)
+	assert.Equal(t, 1, len(rm.ScopeMetrics))
+	assert.Equal(t, 1, len(rm.ScopeMetrics[0].Metrics))
+	m := rm.ScopeMetrics[0].Metrics[0]
+	assert.Equal(t, "requests", m.Name)
+	assert.Equal(t, int64(3), m.Data.(metricdata.Sum[int64]).DataPoints[0].Value)
+
+	stubTB.Finish()
+	assert.True(t, ogMP == otel.GetMeterProvider())
+}
+
+func TestStubWithPropagator(t *testing.T) {
+	ogDefault := propagation.TraceContext{}
+	otelkit.SetDefaultPropagator(ogDefault)
+	t.Cleanup(func() { otelkit.SetDefaultPropagator(nil) })
+
+	stubTB := &testcase.StubTB{}
+	stub := otelkit.StubWithPropagator(stubTB)
+	assert.ContainExactly(t, stub.Propagator.Fields(), otelkit.DefaultPropagator().Fields())
+	assert.Contain(t, otelkit.DefaultPropagator().Fields(), "baggage")
+
+	stubTB.Finish()
+	assert.Equal[propagation.TextMapPropagator](t, ogDefault, otelkit.DefaultPropagator())
+}
+
+func TestServeAndCapture(t *testing.T) {
+	handler := otelkit.HTTPMiddlewareTracing{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+		SpanNameFn: func(r *http.Request) string { return "SpanName" },
+	}
+
+	resp, spans := otelkit.ServeAndCapture(t, handler, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, "SpanName", spans[0].Name())
+}
+
+func TestMakeMalformedTracingRequest(t *testing.T) {
+	req := otelkit.MakeMalformedTracingRequest(http.MethodGet, "/foo", nil)
+	assert.NotEmpty(t, req.Header.Get("traceparent"))
+
+	sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(req.Header)))
+	assert.False(t, sc.IsValid())
+
+	var events []otelkit.NoTracingWarningEvent
+	otelkit.HTTPMiddlewareNoTracingWarning{
+		Next:       http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		Propagator: propagation.TraceContext{},
+		NotifyFn:   func(event otelkit.NoTracingWarningEvent) { events = append(events, event) },
+	}.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, otelkit.NoTracingReasonInvalid, events[0].Reason)
+	assert.Empty(t, events[0].MissingHeaders)
+}
+
+func TestNewTracedTestClient(t *testing.T) {
+	var receivedTraceParent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedTraceParent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer srv.Close()
+
+	client, exp := otelkit.NewTracedTestClient(t)
+	resp, err := client.Get(srv.URL)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+
+	spans := exp.ExportedSpans()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Contain(t, receivedTraceParent, spans[0].SpanContext().TraceID().String())
+	assert.Contain(t, receivedTraceParent, spans[0].SpanContext().SpanID().String())
+}
+
+func TestStub_restoresTheOriginalTracerProvider(t *testing.T) {
+	ogTP := otel.GetTracerProvider()
+
+	t.Run("even when the test panics", func(t *testing.T) {
+		stubTB := &testcase.StubTB{}
+		out := sandbox.Run(func() {
+			otelkit.Stub(stubTB)
+			panic("boom")
+		})
+		assert.False(t, out.OK)
+		assert.True(t, ogTP != otel.GetTracerProvider())
+
+		stubTB.Finish()
+		assert.True(t, ogTP == otel.GetTracerProvider())
+	})
+
+	t.Run("before the stub is shut down", func(t *testing.T) {
+		stubTB := &testcase.StubTB{}
+		stub := otelkit.Stub(stubTB)
+		var globalAtShutdown trace.TracerProvider
+		stub.TracerProvider.RegisterSpanProcessor(shutdownSpyProcessor{OnShutdown: func() {
+			globalAtShutdown = otel.GetTracerProvider()
+		}})
+
+		stubTB.Finish()
+		assert.True(t, ogTP == globalAtShutdown)
+		assert.True(t, ogTP == otel.GetTracerProvider())
+	})
+
+	t.Run("with nested stubs", func(t *testing.T) {
+		outerTB := &testcase.StubTB{}
+		outer := otelkit.Stub(outerTB)
+		innerTB := &testcase.StubTB{}
+		otelkit.Stub(innerTB)
+
+		innerTB.Finish()
+		assert.True(t, outer.TracerProvider == otel.GetTracerProvider())
+		outerTB.Finish()
+		assert.True(t, ogTP == otel.GetTracerProvider())
+	})
+}
+
+type shutdownSpyProcessor struct {
+	traceSDK.SpanProcessor
+	OnShutdown func()
+}
+
+func (p shutdownSpyProcessor) Shutdown(context.Context) error {
+	p.OnShutdown()
+	return nil
+}
+
+func TestRegisterSpanDump(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	_, span := NewTracerProvider(exp).Tracer("TracerName").Start(context.Background(), "DumpedSpan")
+	span.End()
+
+	t.Run("passing test", func(t *testing.T) {
+		stub := &testcase.StubTB{}
+		otelkit.RegisterSpanDump(stub, exp)
+		stub.Finish()
+		assert.NotContain(t, stub.Logs.String(), "DumpedSpan")
+	})
+
+	t.Run("failing test", func(t *testing.T) {
+		stub := &testcase.StubTB{}
+		otelkit.RegisterSpanDump(stub, exp)
+		stub.Fail()
+		stub.Finish()
+		assert.Contain(t, stub.Logs.String(), "DumpedSpan")
+	})
+
+	t.Run("TB without Failed", func(t *testing.T) {
+		stub := &testcase.StubTB{}
+		otelkit.RegisterSpanDump(tbWithoutFailed{stub}, exp)
+		stub.Finish()
+		assert.Contain(t, stub.Logs.String(), "DumpedSpan")
+	})
+}
+
+// tbWithoutFailed hides the Failed method of the wrapped TB, like a minimal fake TB would lack it.
+type tbWithoutFailed struct{ tb testing.TB }
+
+func (tb tbWithoutFailed) Helper()                           { tb.tb.Helper() }
+func (tb tbWithoutFailed) Cleanup(fn func())                 { tb.tb.Cleanup(fn) }
+func (tb tbWithoutFailed) Logf(format string, args ...any)   { tb.tb.Logf(format, args...) }
+func (tb tbWithoutFailed) Fatalf(format string, args ...any) { tb.tb.Fatalf(format, args...) }
+func (tb tbWithoutFailed) Errorf(format string, args ...any) { tb.tb.Errorf(format, args...) }
+
+func TestMakeTracedContext(t *testing.T) {
+	t.Run("with baggage", func(t *testing.T) {
+		a, err := baggage.NewMember("a", "1")
+		assert.NoError(t, err)
+		b, err := baggage.NewMember("b", "2")
+		assert.NoError(t, err)
+
+		ctx, span := otelkit.MakeTracedContext(t, a, b)
+		assert.True(t, span.SpanContext().IsValid())
+		assert.True(t, span.IsRecording())
+		assert.Equal(t, span.SpanContext(), trace.SpanContextFromContext(ctx))
+		otelkit.AssertBaggage(t, ctx, "a", "1")
+		otelkit.AssertBaggage(t, ctx, "b", "2")
+	})
+
+	t.Run("without baggage", func(t *testing.T) {
+		ctx, span := otelkit.MakeTracedContext(t)
+		assert.True(t, span.SpanContext().IsValid())
+		assert.Equal(t, 0, baggage.FromContext(ctx).Len())
+	})
+
+	t.Run("span is ended on cleanup", func(t *testing.T) {
+		stub := &testcase.StubTB{}
+		_, span := otelkit.MakeTracedContext(stub)
+		assert.True(t, span.IsRecording())
+		stub.Finish()
+		assert.False(t, span.IsRecording())
+	})
+}
+
+func TestSpanSummary(t *testing.T) {
+	exp := &otelkit.FakeSpanExporter{}
+	tracer := NewTracerProvider(exp).Tracer("TracerName")
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, span := tracer.Start(ctx, "child",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("key", "value"), attribute.Int("n", 42)))
+	span.SetStatus(codes.Error, "boom")
+	span.End()
+	parent.End()
+
+	spans := exp.ExportedSpans()
+	assert.Equal(t, 2, len(spans))
+	summary := otelkit.SpanSummary(spans[0])
+	assert.NotContain(t, summary, "\n")
+	assert.Contain(t, summary, `"child"`)
+	assert.Contain(t, summary, "trace_id="+span.SpanContext().TraceID().String())
+	assert.Contain(t, summary, "span_id="+span.SpanContext().SpanID().String())
+	assert.Contain(t, summary, "parent_span_id="+parent.SpanContext().SpanID().String())
+	assert.Contain(t, summary, "kind=client")
+	assert.Contain(t, summary, `status=Error("boom")`)
+	assert.Contain(t, summary, "key=value")
+	assert.Contain(t, summary, "n=42")
+
+	assert.NotContain(t, otelkit.SpanSummary(spans[1]), "parent_span_id")
+}
+
 func TestFakeSpanExporter_race(t *testing.T) {
 	rnd := random.New(random.CryptoSeed{})
 	exp := &otelkit.FakeSpanExporter{}
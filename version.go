@@ -0,0 +1,8 @@
+package otelkit
+
+// instrumentationName is the instrumentation scope name of the tracers and meters that otelkit obtains from the providers.
+const instrumentationName = "github.com/adamluzsi/otelkit"
+
+// Version is the version of otelkit.
+// It's the instrumentation scope version of the tracers and meters that otelkit obtains from the providers.
+const Version = "0.1.0"